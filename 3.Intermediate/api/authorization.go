@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles known to the API. Users get roles through the roles column of the
+// users table, e.g. update users set roles = '{admin}' where user_name = '...'
+const (
+	RoleAdmin = "admin"
+)
+
+// Scopes known to the API. They come from the scopes column of the users
+// table, the same way as roles.
+const (
+	// ScopeUsersImport allows POST /users/import, which can overwrite any
+	// password. Being admin is not enough.
+	ScopeUsersImport = "users:import"
+)
+
+var errForbidden = errors.New("not allowed")
+
+// RequireRole lets a request through when the caller has at least one of the
+// given roles. It must run after ValidateToken.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload, ok := AuthPayload(ctx)
+		if !ok {
+			abortUnauthorized(ctx, errAuthRequired)
+			return
+		}
+
+		for _, role := range roles {
+			if payload.HasRole(role) {
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errForbidden))
+	}
+}
+
+// RequireScope lets a request through only when the caller has every one of
+// the given scopes. It must run after ValidateToken.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload, ok := AuthPayload(ctx)
+		if !ok {
+			abortUnauthorized(ctx, errAuthRequired)
+			return
+		}
+
+		for _, scope := range scopes {
+			if !payload.HasScope(scope) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errForbidden))
+				return
+			}
+		}
+	}
+}
+
+// RequireSelfOrRole lets a request through when the user named by the path
+// parameter param is the caller, or when the caller has one of the given
+// roles. It must run after ValidateToken.
+func RequireSelfOrRole(param string, roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload, ok := AuthPayload(ctx)
+		if !ok {
+			abortUnauthorized(ctx, errAuthRequired)
+			return
+		}
+
+		if payload.Username == ctx.Param(param) {
+			return
+		}
+		for _, role := range roles {
+			if payload.HasRole(role) {
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errForbidden))
+	}
+}
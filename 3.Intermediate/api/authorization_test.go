@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+)
+
+func TestRouteAuthorization(t *testing.T) {
+	server := newTestServer(t)
+	createTestUser(t, server, "dave", "secret-password")
+
+	user := testAccessToken(t, server, token.Identity{Username: "carol"})
+	admin := testAccessToken(t, server, token.Identity{Username: "root", Roles: []string{RoleAdmin}})
+	importer := testAccessToken(t, server, token.Identity{
+		Username: "root",
+		Roles:    []string{RoleAdmin},
+		Scopes:   []string{ScopeUsersImport},
+	})
+	scopeOnly := testAccessToken(t, server, token.Identity{Username: "carol", Scopes: []string{ScopeUsersImport}})
+
+	imported := importUsersRequest{Users: []db.UserRequest{{
+		UserName:  "ivy",
+		Email:     "ivy@example.com",
+		Password:  "secret-password",
+		FirstName: "Ivy",
+		LastName:  "I",
+	}}}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		accessToken string
+		body        interface{}
+		want        int
+	}{
+		// RequireRole
+		{"list users as user", http.MethodGet, "/users", user, nil, http.StatusForbidden},
+		{"list users as admin", http.MethodGet, "/users", admin, nil, http.StatusOK},
+		// RequireSelfOrRole
+		{"update someone else", http.MethodPatch, "/users/dave", user, gin.H{"first_name": "D"}, http.StatusForbidden},
+		{"update as admin", http.MethodPatch, "/users/dave", admin, gin.H{"first_name": "D"}, http.StatusOK},
+		// RequireScope, behind RequireRole
+		{"import as admin without the scope", http.MethodPost, "/users/import", admin, imported, http.StatusForbidden},
+		{"import with the scope but no role", http.MethodPost, "/users/import", scopeOnly, imported, http.StatusForbidden},
+		{"import with role and scope", http.MethodPost, "/users/import", importer, imported, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(server, tt.method, tt.path, tt.accessToken, tt.body); w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+// RequireScope wants every scope it names, RequireRole any of its roles
+func TestRequireAllScopesAnyRole(t *testing.T) {
+	server := newTestServer(t)
+
+	router := gin.New()
+	auth := router.Group("/", server.ValidateToken())
+	auth.GET("/scopes", RequireScope("a", "b"), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	auth.GET("/roles", RequireRole("x", "y"), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	server.router = router
+
+	tests := []struct {
+		path     string
+		identity token.Identity
+		want     int
+	}{
+		{"/scopes", token.Identity{Username: "u", Scopes: []string{"a", "b"}}, http.StatusOK},
+		{"/scopes", token.Identity{Username: "u", Scopes: []string{"a"}}, http.StatusForbidden},
+		{"/scopes", token.Identity{Username: "u"}, http.StatusForbidden},
+		{"/roles", token.Identity{Username: "u", Roles: []string{"y"}}, http.StatusOK},
+		{"/roles", token.Identity{Username: "u", Roles: []string{"z"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := serve(server, http.MethodGet, tt.path, testAccessToken(t, server, tt.identity), nil)
+		if w.Code != tt.want {
+			t.Errorf("%s with %+v: got %d, want %d", tt.path, tt.identity, w.Code, tt.want)
+		}
+	}
+}
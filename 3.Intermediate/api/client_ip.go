@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientIP is the address a request is rate limited and logged under. It
+// is the address the request came from, unless that is one of
+// TRUSTED_PROXIES: then it is the last X-Forwarded-For entry that was not
+// added by a trusted proxy. gin's ClientIP believes the header of anyone.
+func (server *Server) clientIP(ctx *gin.Context) string {
+	host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil {
+		host = ctx.Request.RemoteAddr
+	}
+	if !server.isTrustedProxy(host) {
+		return host
+	}
+
+	// Every proxy appends the address it got the request from. Entries to
+	// the left of the first untrusted one were sent by the client and can
+	// say anything.
+	hops := strings.Split(strings.Join(ctx.Request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !server.isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+func (server *Server) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range server.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+)
+
+// nginx' non standard status for a client that closed the connection
+const statusClientClosedRequest = 499
+
+// Error codes sent next to the message. Messages may change, these don't.
+const (
+	codeNotFound                = "not_found"
+	codeUserNotFound            = "user_not_found"
+	codeInvalidCredentials      = "invalid_credentials"
+	codeCurrentPasswordRequired = "current_password_required"
+	codeDuplicateEmail          = "duplicate_email"
+	codeDuplicateUserName       = "duplicate_user_name"
+	codeConstraintViolation     = "constraint_violation"
+	codeInvalidCursor           = "invalid_cursor"
+	codeInvalidSortField        = "invalid_sort_field"
+	codeRateLimited             = "rate_limited"
+	codeRequestCanceled         = "request_canceled"
+	codeTimeout                 = "timeout"
+	codeInternal                = "internal_error"
+)
+
+var (
+	errInternal     = errors.New("internal server error")
+	errUserNotFound = errors.New("user not found")
+	// errInvalidCredentials does not say which half was wrong, so /login
+	// cannot be used to find out which user names exist
+	errInvalidCredentials = errors.New("invalid user name or password")
+
+	errCurrentPasswordRequired = errors.New("current_password is required to change the email or password")
+	errWrongCurrentPassword    = errors.New("current_password is wrong")
+)
+
+// storeErrorResponse maps an error from the store to a status and a body.
+// Unexpected errors are logged and not shown to the client.
+func storeErrorResponse(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return http.StatusNotFound, errorCodeResponse(codeNotFound, err)
+	case errors.Is(err, db.ErrDuplicateEmail):
+		return http.StatusConflict, errorCodeResponse(codeDuplicateEmail, err)
+	case errors.Is(err, db.ErrDuplicateUserName):
+		return http.StatusConflict, errorCodeResponse(codeDuplicateUserName, err)
+	case errors.Is(err, db.ErrConstraintViolation):
+		return http.StatusUnprocessableEntity, errorCodeResponse(codeConstraintViolation, err)
+	case errors.Is(err, db.ErrInvalidCursor):
+		return http.StatusBadRequest, errorCodeResponse(codeInvalidCursor, err)
+	case errors.Is(err, db.ErrInvalidSortField):
+		return http.StatusBadRequest, errorCodeResponse(codeInvalidSortField, err)
+	case errors.Is(err, db.ErrQueryCanceled):
+		return statusClientClosedRequest, errorCodeResponse(codeRequestCanceled, db.ErrQueryCanceled)
+	case errors.Is(err, db.ErrQueryTimeout):
+		return http.StatusGatewayTimeout, errorCodeResponse(codeTimeout, db.ErrQueryTimeout)
+	default:
+		l.E(err)
+		return http.StatusInternalServerError, errorCodeResponse(codeInternal, errInternal)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+)
+
+// Verifiers cache the key set for a few minutes. A rotated key must be
+// published at least this long before it starts signing.
+const jwksCacheControl = "public, max-age=300, must-revalidate"
+
+func (server *Server) getJWKS(ctx *gin.Context) {
+	publisher, ok := server.tokener.(token.KeyPublisher)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(errors.New("no public keys configured")))
+		return
+	}
+
+	keys, ok := publisher.JWKS()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(errors.New("no public keys configured")))
+		return
+	}
+
+	body, err := json.Marshal(keys)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	ctx.Header("Cache-Control", jwksCacheControl)
+	ctx.Header("ETag", etag)
+	if ctx.GetHeader("If-None-Match") == etag {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	ctx.Data(http.StatusOK, "application/json", body)
+}
@@ -2,24 +2,47 @@ package api
 
 import (
 	"errors"
+	"io"
 	"net/http"
-	"time"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
 )
 
 type loginUserRequest struct {
 	Username string `json:"user_name" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required,min=6" secret:"true"`
 }
 
 type loginUserResponse struct {
-	AccessToken string          `json:"access_token"`
-	User        db.UserResponse `json:"user"`
+	tokenPair
+	User userResponse `json:"user"`
 }
 
+var (
+	unknownUserHashOnce sync.Once
+	unknownUserHashed   string
+)
+
+// unknownUserHash is a bcrypt hash to check passwords of unknown users against
+func unknownUserHash() string {
+	unknownUserHashOnce.Do(func() {
+		hash, err := util.HashPassword("unknown user")
+		if err != nil {
+			l.E(err)
+		}
+		unknownUserHashed = hash
+	})
+	return unknownUserHashed
+}
+
+// loginUser answers 401 invalid_credentials for an unknown user name and for
+// a wrong password alike
 func (server *Server) loginUser(ctx *gin.Context) {
 	var req loginUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -27,30 +50,73 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		return
 	}
 
-	user, err := server.store.GetUserByUserName(ctx, req.Username)
+	user, err := server.store.GetUserByUserName(ctx.Request.Context(), req.Username)
+	if errors.Is(err, db.ErrNotFound) {
+		// Spend as long as for a wrong password, the response time must
+		// not tell either
+		util.CheckPassword(req.Password, unknownUserHash())
+		ctx.JSON(http.StatusUnauthorized, errorCodeResponse(codeInvalidCredentials, errInvalidCredentials))
+		return
+	}
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		ctx.JSON(storeErrorResponse(err))
 		return
 	}
 
 	err = util.CheckPassword(req.Password, user.HashedPassword)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(errors.New("Incorrect password")))
+		ctx.JSON(http.StatusUnauthorized, errorCodeResponse(codeInvalidCredentials, errInvalidCredentials))
 		return
 	}
 
-	accessToken, err := server.tokener.CreateToken(
-		user.UserName,
-		1*time.Hour,
-	)
+	pair, _, err := server.issueTokens(ctx, server.store, user, uuid.Nil)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		ctx.JSON(storeErrorResponse(err))
 		return
 	}
 
 	rsp := loginUserResponse{
-		AccessToken: accessToken,
-		User:        user,
+		tokenPair: pair,
+		User:      newUserResponse(user, viewSelf),
 	}
 	ctx.JSON(http.StatusOK, rsp)
 }
+
+type logoutUserRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// logoutUser revokes the access token used for the request. When the refresh
+// token is sent along, every session of that login is ended as well.
+func (server *Server) logoutUser(ctx *gin.Context) {
+	payload, ok := AuthPayload(ctx)
+	if !ok {
+		abortUnauthorized(ctx, errAuthRequired)
+		return
+	}
+
+	var req logoutUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	err := server.revoker.RevokeToken(ctx.Request.Context(), payload.ID, payload.ExpiredAt.Time)
+	if err != nil {
+		ctx.JSON(storeErrorResponse(err))
+		return
+	}
+
+	if req.RefreshToken != "" {
+		session, err := server.store.GetSessionByTokenHash(ctx.Request.Context(), token.HashRefreshToken(req.RefreshToken))
+		if err == nil && session.UserName == payload.Username {
+			err = server.store.BlockSessionFamily(ctx.Request.Context(), session.FamilyID)
+		}
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(storeErrorResponse(err))
+			return
+		}
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
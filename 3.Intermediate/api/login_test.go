@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Unknown users and wrong passwords must look the same from the outside
+func TestLoginDoesNotRevealUsers(t *testing.T) {
+	server := newTestServer(t)
+	createTestUser(t, server, "dave", "secret-password")
+
+	login := func(userName, password string) *httptest.ResponseRecorder {
+		return serve(server, http.MethodPost, "/login", "", loginUserRequest{Username: userName, Password: password})
+	}
+
+	unknown := login("nobody", "secret-password")
+	wrong := login("dave", "wrong-password")
+	for name, w := range map[string]*httptest.ResponseRecorder{"unknown user": unknown, "wrong password": wrong} {
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want 401", name, w.Code)
+		}
+		var rsp struct{ Code string }
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil || rsp.Code != codeInvalidCredentials {
+			t.Errorf("%s: body %s", name, w.Body)
+		}
+	}
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Errorf("bodies differ:\n%s\n%s", unknown.Body, wrong.Body)
+	}
+
+	if w := login("dave", "secret-password"); w.Code != http.StatusOK {
+		t.Errorf("right password: got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server on an empty MemStore. The options change
+// the config before the server is made from it.
+func newTestServer(t *testing.T, options ...func(config *util.Config)) *Server {
+	t.Helper()
+
+	config := util.Config{
+		TokenSymmetricKey:    "tR8cVn2LqW5xZ0pK7sD4fG1hJ9mB3yUe",
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	server, err := NewServer(config, db.NewMemStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// serve sends a request through the router. body is sent as JSON unless it
+// is nil, accessToken as a bearer token unless it is empty.
+func serve(server *Server, method string, path string, accessToken string, body interface{}) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if accessToken != "" {
+		req.Header.Set(authorizationHeaderKey, "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+// createTestUser stores a user with the given password straight through
+// the store
+func createTestUser(t *testing.T, server *Server, userName string, password string) {
+	t.Helper()
+
+	_, err := server.store.CreateUser(context.Background(), db.UserRequest{
+		UserName:  userName,
+		Email:     userName + "@example.com",
+		Password:  password,
+		FirstName: userName,
+		LastName:  "Test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loginTestUser logs in through /login and fails the test unless it works
+func loginTestUser(t *testing.T, server *Server, userName string, password string) loginUserResponse {
+	t.Helper()
+
+	w := serve(server, http.MethodPost, "/login", "", loginUserRequest{Username: userName, Password: password})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: %d %s", userName, w.Code, w.Body)
+	}
+	var rsp loginUserResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	return rsp
+}
+
+// testAccessToken signs an access token for identity without a login, the
+// user does not need to exist
+func testAccessToken(t *testing.T, server *Server, identity token.Identity) string {
+	t.Helper()
+
+	accessToken, err := server.tokener.CreateToken(identity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accessToken
+}
+
+// nextSecond waits for the next whole second. iat only has whole seconds,
+// so tokens are only rejected by a revocation in a later second.
+func nextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
+
+// wantErrorCode fails the test unless w has the status and error code
+func wantErrorCode(t *testing.T, name string, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	var rsp struct{ Code string }
+	json.Unmarshal(w.Body.Bytes(), &rsp)
+	if w.Code != status || rsp.Code != code {
+		t.Errorf("%s: got %d %s, want %d %s", name, w.Code, w.Body, status, code)
+	}
+}
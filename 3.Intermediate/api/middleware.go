@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+)
+
+const (
+	authorizationHeaderKey  = "Authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload"
+)
+
+var (
+	errAuthRequired        = errors.New("authorization header is required")
+	errInvalidAuthHeader   = errors.New("invalid authorization header format")
+	errUnsupportedAuthType = errors.New("unsupported authorization type")
+	errTokenRevoked        = errors.New("token has been revoked")
+)
+
+// ValidateToken is the authentication middleware. It accepts
+// "Authorization: Bearer <token>" with the scheme in any case, and stores the
+// verified payload for AuthPayload. Every failure is a 401 with a
+// WWW-Authenticate challenge as described in RFC 6750.
+func (server *Server) ValidateToken() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authHeader := ctx.GetHeader(authorizationHeaderKey)
+		if authHeader == "" {
+			abortUnauthorized(ctx, errAuthRequired)
+			return
+		}
+
+		fields := strings.Fields(authHeader)
+		if len(fields) != 2 {
+			abortUnauthorized(ctx, errInvalidAuthHeader)
+			return
+		}
+
+		if strings.ToLower(fields[0]) != authorizationTypeBearer {
+			abortUnauthorized(ctx, errUnsupportedAuthType)
+			return
+		}
+
+		payload, err := server.tokener.VerifyToken(fields[1])
+		if err != nil {
+			abortUnauthorized(ctx, err)
+			return
+		}
+
+		revoked, err := server.revoker.IsTokenRevoked(ctx.Request.Context(), payload.ID, payload.Username, payload.IssuedAt.Time)
+		if err != nil {
+			ctx.AbortWithStatusJSON(storeErrorResponse(err))
+			return
+		}
+		if revoked {
+			abortUnauthorized(ctx, errTokenRevoked)
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+// AuthPayload returns the token payload of the caller.
+// ok is false when the route is not behind ValidateToken.
+func AuthPayload(ctx *gin.Context) (payload *token.Payload, ok bool) {
+	v, exists := ctx.Get(authorizationPayloadKey)
+	if !exists {
+		return nil, false
+	}
+	payload, ok = v.(*token.Payload)
+	return payload, ok
+}
+
+func abortUnauthorized(ctx *gin.Context, err error) {
+	challenge := `Bearer realm="api"`
+	if err != errAuthRequired {
+		// A missing header gets the bare challenge, see RFC 6750 section 3.1
+		challenge += `, error="invalid_token"`
+	}
+
+	ctx.Header("WWW-Authenticate", challenge)
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+}
+
+// dbDeadline puts a deadline on the request context. Handlers pass that
+// context to the store, so database work stops once the deadline passes or
+// the client disconnects.
+func dbDeadline(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(c)
+		ctx.Next()
+	}
+}
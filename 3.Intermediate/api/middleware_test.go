@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+func TestValidateToken(t *testing.T) {
+	server := newTestServer(t)
+
+	valid := testAccessToken(t, server, token.Identity{Username: "alice"})
+	revoked := testAccessToken(t, server, token.Identity{Username: "alice"})
+	payload, err := server.tokener.VerifyToken(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.revoker.RevokeToken(context.Background(), payload.ID, payload.ExpiredAt.Time); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/", server.ValidateToken(), func(ctx *gin.Context) {
+		payload, ok := AuthPayload(ctx)
+		if !ok {
+			t.Error("AuthPayload is not set")
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+		ctx.String(http.StatusOK, payload.Username)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"scheme only", "Bearer", http.StatusUnauthorized},
+		{"scheme and space", "Bearer ", http.StatusUnauthorized},
+		{"too many fields", "Bearer " + valid + " extra", http.StatusUnauthorized},
+		{"other scheme", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized},
+		{"bad token", "Bearer not-a-token", http.StatusUnauthorized},
+		{"lowercase bad token", "bearer not-a-token", http.StatusUnauthorized},
+		{"revoked token", "Bearer " + revoked, http.StatusUnauthorized},
+		{"valid", "Bearer " + valid, http.StatusOK},
+		{"lowercase scheme", "bearer " + valid, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(authorizationHeaderKey, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusOK {
+				if w.Body.String() != "alice" {
+					t.Errorf("handler saw %q", w.Body)
+				}
+				return
+			}
+			if !strings.HasPrefix(challenge, `Bearer realm="api"`) {
+				t.Errorf("WWW-Authenticate is %q", challenge)
+			}
+			if tt.header != "" && !strings.Contains(challenge, `error="invalid_token"`) {
+				t.Errorf("WWW-Authenticate has no error: %q", challenge)
+			}
+		})
+	}
+}
+
+// slowStore blocks every user lookup until the context is done, like a
+// query stuck behind a lock
+type slowStore struct {
+	db.Store
+}
+
+func (s slowStore) GetUserByUserName(ctx context.Context, userName string) (db.UserResponse, error) {
+	<-ctx.Done()
+	return s.Store.GetUserByUserName(ctx, userName)
+}
+
+func TestStoreDeadlineAndCancel(t *testing.T) {
+	server := newTestServer(t, func(config *util.Config) {
+		config.DBRequestTimeout = 20 * time.Millisecond
+	})
+	server.store = slowStore{server.store}
+
+	login := func(ctx context.Context) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(loginUserRequest{Username: "alice", Password: "secret-password"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// DB_REQUEST_TIMEOUT passes while the store is busy
+	wantErrorCode(t, "deadline", login(context.Background()), http.StatusGatewayTimeout, codeTimeout)
+
+	// The client goes away first
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+	wantErrorCode(t, "canceled", login(ctx), statusClientClosedRequest, codeRequestCanceled)
+}
+
+// REVOCATION_STORE=memory keeps revocations apart from the users
+func TestMemoryRevocationStore(t *testing.T) {
+	server := newTestServer(t, func(config *util.Config) {
+		config.RevocationStore = "memory"
+	})
+	createTestUser(t, server, "lia", "secret-password")
+	session := loginTestUser(t, server, "lia", "secret-password")
+
+	if w := serve(server, http.MethodPost, "/logout", session.AccessToken, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("logout: %d %s", w.Code, w.Body)
+	}
+	if w := serve(server, http.MethodGet, "/authUser", session.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("after logout: got %d, want 401", w.Code)
+	}
+
+	payload, err := server.tokener.VerifyToken(session.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := server.store.IsTokenRevoked(context.Background(), payload.ID, payload.Username, payload.IssuedAt.Time)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Error("the revocation went to the user store")
+	}
+}
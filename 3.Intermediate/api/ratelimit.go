@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdle is how long a client is remembered after its last request
+const rateLimiterIdle = 3 * time.Minute
+
+// maxRateLimitClients caps the number of clients remembered at once, so
+// requests from many addresses cannot use up the memory
+const maxRateLimitClients = 100000
+
+var errRateLimited = errors.New("too many requests")
+
+// rateLimiter hands out a token bucket per client IP, see clientIP. The limit can change
+// while requests are served, see setLimit.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*rateClient
+	lastSweep time.Time
+	// maxClients is maxRateLimitClients, tests lower it
+	maxClients int
+	lastEvict  time.Time
+}
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		clients:    make(map[string]*rateClient),
+		maxClients: maxRateLimitClients,
+	}
+}
+
+// setLimit allows limit requests per second with bursts of burst.
+// A limit of 0 lets every request through.
+func (rl *rateLimiter) setLimit(limit float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.limit, rl.burst = rate.Limit(limit), burst
+	for _, c := range rl.clients {
+		c.limiter.SetLimit(rl.limit)
+		c.limiter.SetBurst(rl.burst)
+	}
+}
+
+// allow reports whether client may make a request now, and if not how long
+// it should wait
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.limit <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > rateLimiterIdle {
+		for ip, c := range rl.clients {
+			if now.Sub(c.lastSeen) > rateLimiterIdle {
+				delete(rl.clients, ip)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	c, ok := rl.clients[client]
+	if !ok {
+		if len(rl.clients) >= rl.maxClients {
+			rl.evict(now)
+		}
+		c = &rateClient{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[client] = c
+	}
+	c.lastSeen = now
+
+	if c.limiter.AllowN(now, 1) {
+		return true, 0
+	}
+	return false, time.Duration(float64(time.Second) / float64(rl.limit))
+}
+
+// evict makes room for one more client. Clients whose bucket has filled up
+// again are no different from new ones, so they go first. When every
+// client is busy an arbitrary one is forgotten.
+func (rl *rateLimiter) evict(now time.Time) {
+	// Scanning every client for each new one would be slow while the map
+	// is full, so scan at most once a second
+	if now.Sub(rl.lastEvict) >= time.Second {
+		refill := time.Duration(float64(rl.burst) / float64(rl.limit) * float64(time.Second))
+		for ip, c := range rl.clients {
+			if now.Sub(c.lastSeen) >= refill {
+				delete(rl.clients, ip)
+			}
+		}
+		rl.lastEvict = now
+	}
+
+	for ip := range rl.clients {
+		if len(rl.clients) < rl.maxClients {
+			return
+		}
+		delete(rl.clients, ip)
+	}
+}
+
+// rateLimit answers 429 with a Retry-After header to clients that go over
+// RATE_LIMIT
+func (server *Server) rateLimit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ok, wait := server.limiter.allow(server.clientIP(ctx))
+		if !ok {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, errorCodeResponse(codeRateLimited, errRateLimited))
+			return
+		}
+		ctx.Next()
+	}
+}
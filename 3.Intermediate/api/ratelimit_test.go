@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+func TestRateLimitReload(t *testing.T) {
+	server := newTestServer(t, func(config *util.Config) {
+		config.RateLimit = 0.5
+		config.RateLimitBurst = 2
+	})
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/authUser", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("10.0.0.1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d within the burst: %d", i, w.Code)
+		}
+	}
+	w := get("10.0.0.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("got %d, Retry-After %q, want 429 and 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("10.0.0.2"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("other clients are limited too: %d", w.Code)
+	}
+
+	config := server.config
+	config.RateLimit = 0
+	server.Reload(config)
+	if w := get("10.0.0.1"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("still limited after turning it off: %d", w.Code)
+	}
+}
+
+func TestReloadTokenDurations(t *testing.T) {
+	server := newTestServer(t)
+
+	config := server.config
+	config.AccessTokenDuration = 5 * time.Minute
+	server.Reload(config)
+	if ttl := server.currentTunables(); ttl.accessTokenDuration != 5*time.Minute || ttl.refreshTokenDuration != time.Hour {
+		t.Fatalf("got %+v", ttl)
+	}
+}
+
+// Clients must not get a fresh bucket by making up forwarding headers
+func TestRateLimitIgnoresSpoofedHeaders(t *testing.T) {
+	server := newTestServer(t, func(config *util.Config) {
+		config.RateLimit = 0.5
+		config.RateLimitBurst = 2
+		config.TrustedProxies = []string{"10.0.0.0/8"}
+	})
+
+	get := func(remoteAddr string, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/authUser", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-Ip", forwardedFor)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A client that talks to the server directly
+	for i, spoofed := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		want := http.StatusUnauthorized
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if code := get("198.51.100.7:1234", spoofed); code != want {
+			t.Fatalf("direct request %d: got %d, want %d", i, code, want)
+		}
+	}
+
+	// A client behind the proxy, which appends the address it sees
+	for i, spoofed := range []string{"192.0.2.1", "192.0.2.2, 10.0.0.9", "10.0.0.3"} {
+		want := http.StatusUnauthorized
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if code := get("10.0.0.1:1234", spoofed+", 203.0.113.5"); code != want {
+			t.Fatalf("proxied request %d: got %d, want %d", i, code, want)
+		}
+	}
+	if code := get("10.0.0.1:1234", "203.0.113.6"); code != http.StatusUnauthorized {
+		t.Fatalf("other client behind the proxy: got %d", code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	networks, err := util.ParseNetworks([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{trustedProxies: networks}
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"198.51.100.7:1234", nil, "198.51.100.7"},
+		{"198.51.100.7:1234", []string{"192.0.2.1"}, "198.51.100.7"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"192.0.2.1, 203.0.113.5"}, "203.0.113.5"},
+		{"10.0.0.1:1234", []string{"192.0.2.1", "203.0.113.5, 10.0.0.2"}, "203.0.113.5"},
+		{"10.0.0.1:1234", []string{"not-an-ip, 10.0.0.2"}, "10.0.0.2"},
+		{"[2001:db8::1]:1234", []string{"2001:db8::2"}, "2001:db8::2"},
+		{"[2001:db8::3]:1234", []string{"192.0.2.1"}, "2001:db8::3"},
+	}
+	for _, tt := range tests {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx.Request.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.forwardedFor {
+			ctx.Request.Header.Add("X-Forwarded-For", v)
+		}
+		if got := server.clientIP(ctx); got != tt.want {
+			t.Errorf("%s %v: got %s, want %s", tt.remoteAddr, tt.forwardedFor, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterCapsClients(t *testing.T) {
+	rl := newRateLimiter()
+	rl.maxClients = 10
+	rl.setLimit(0.5, 1)
+
+	for i := 0; i < 100; i++ {
+		rl.allow(fmt.Sprintf("192.0.2.%d", i))
+		if len(rl.clients) > rl.maxClients {
+			t.Fatalf("%d clients after %d requests", len(rl.clients), i+1)
+		}
+	}
+	if ok, _ := rl.allow("192.0.2.99"); ok {
+		t.Error("the newest client was forgotten")
+	}
+}
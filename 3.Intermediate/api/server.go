@@ -1,56 +1,208 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
 )
 
+const defaultRevocationPruneInterval = 10 * time.Minute
+
 // Server will server HTTP requests
 type Server struct {
+	config  util.Config
 	store   db.Store
+	revoker db.TokenRevoker
 	router  *gin.Engine
 	tokener token.Tokener
+	limiter *rateLimiter
+	// trustedProxies may set X-Forwarded-For, see clientIP
+	trustedProxies []*net.IPNet
+	// httpServer serves router, see Start and Shutdown
+	httpServer *http.Server
+	// tunables holds a tunables value, Reload swaps it as a whole
+	tunables atomic.Value
+}
+
+// tunables are the settings that can change while the server runs
+type tunables struct {
+	accessTokenDuration  time.Duration
+	refreshTokenDuration time.Duration
+	// config is the config of the last Reload
+	config util.Config
 }
 
 // NewServer creates a new HTTP server and set up routing.
-func NewServer(store db.Store) (*Server, error) {
-	tokener, err := token.NewJWTToken("12345678901234567890123456789012")
+func NewServer(config util.Config, store db.Store) (*Server, error) {
+	tokener, err := token.NewTokener(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tokener: %w", err)
 	}
 
+	trustedProxies, err := util.ParseNetworks(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
 	server := &Server{
-		store:   store,
-		tokener: tokener,
+		config:         config,
+		store:          store,
+		revoker:        store,
+		tokener:        tokener,
+		limiter:        newRateLimiter(),
+		trustedProxies: trustedProxies,
+	}
+	server.Reload(config)
+
+	switch config.RevocationStore {
+	case "", "store":
+	case "memory":
+		// Only the revocation part of a MemStore is used, users and
+		// sessions stay in store
+		server.revoker = db.NewMemStore()
+	default:
+		return nil, fmt.Errorf("unsupported revocation store %q", config.RevocationStore)
 	}
 
 	server.setupRouter()
+	server.httpServer = &http.Server{
+		Addr:         config.ServerAddress,
+		Handler:      server.router,
+		ReadTimeout:  config.HTTPReadTimeout,
+		WriteTimeout: config.HTTPWriteTimeout,
+		IdleTimeout:  config.HTTPIdleTimeout,
+	}
 	return server, nil
 }
 
+// Reload applies the token TTLs and rate limits of config to the running
+// server. Other settings are only read by NewServer.
+func (server *Server) Reload(config util.Config) {
+	server.tunables.Store(tunables{
+		accessTokenDuration:  config.AccessTokenDuration,
+		refreshTokenDuration: config.RefreshTokenDuration,
+		config:               config,
+	})
+	server.limiter.setLimit(config.RateLimit, config.RateLimitBurst)
+}
+
+func (server *Server) currentTunables() tunables {
+	return server.tunables.Load().(tunables)
+}
+
 func (server *Server) setupRouter() {
 	router := gin.Default()
+	// Only clientIP knows which proxies to believe
+	router.ForwardedByClientIP = false
+	router.Use(server.rateLimit())
+	if server.config.DBRequestTimeout > 0 {
+		router.Use(dbDeadline(server.config.DBRequestTimeout))
+	}
 
 	router.POST("/login", server.loginUser)
-	router.GET("/users", server.getUsers)
+	router.POST("/tokens/renew", server.renewTokens)
+	router.GET("/.well-known/jwks.json", server.getJWKS)
 	router.POST("/users", server.createUser)
-	//sunday work
-	// router.Group("/auth", server.ValidateToken())
-	// {
-	// router.Use(server.ValidateToken())
-	router.GET("/authUser", server.ValidateToken(), server.getUsers)
-	// }
+
+	authRoutes := router.Group("/", server.ValidateToken())
+	authRoutes.POST("/logout", server.logoutUser)
+	authRoutes.GET("/authUser", server.authUser)
+	authRoutes.PATCH("/users/:username", RequireSelfOrRole("username", RoleAdmin), server.updateUser)
+
+	adminRoutes := authRoutes.Group("/", RequireRole(RoleAdmin))
+	adminRoutes.GET("/users", server.getUsers)
+	adminRoutes.POST("/users/import", RequireScope(ScopeUsersImport), server.importUsers)
+	adminRoutes.GET("/debug/db/stats", server.getDBStats)
+	adminRoutes.GET("/debug/config", server.getConfig)
+
 	server.router = router
 }
 
-// Start runs the HTTP server on a specific address.
-func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+// Start runs the HTTP server on SERVER_ADDRESS, with TLS when a certificate
+// is configured. It blocks until Shutdown is called, which makes it return
+// nil, or until the server fails.
+func (server *Server) Start() error {
+	interval := server.config.RevocationPruneInterval
+	if interval <= 0 {
+		interval = defaultRevocationPruneInterval
+	}
+	ctx, stopPruner := context.WithCancel(context.Background())
+	server.httpServer.RegisterOnShutdown(stopPruner)
+	go db.RunRevocationPruner(ctx, server.revoker, interval)
+
+	l.I("listening on", server.httpServer.Addr)
+	var err error
+	if server.config.TLSCertFile != "" {
+		err = server.httpServer.ListenAndServeTLS(server.config.TLSCertFile, server.config.TLSKeyFile)
+	} else {
+		err = server.httpServer.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for the requests in
+// flight until ctx is done. The store is left open for the caller to close.
+func (server *Server) Shutdown(ctx context.Context) error {
+	return server.httpServer.Shutdown(ctx)
+}
+
+func (server *Server) getDBStats(ctx *gin.Context) {
+	statser, ok := server.store.(db.PoolStatser)
+	if !ok {
+		ctx.JSON(http.StatusNotFound, errorResponse(errors.New("store has no connection pool")))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, statser.PoolStats())
+}
+
+// configSetting is a setting of the effective config, secrets are masked.
+// PendingRestart marks a value that was reloaded but only applies after
+// a restart.
+type configSetting struct {
+	util.ConfigValue
+	PendingRestart bool `json:"pending_restart,omitempty"`
+}
+
+type configResponse struct {
+	Settings []configSetting `json:"settings"`
+}
+
+// getConfig shows the config the server runs with and where each value
+// came from
+func (server *Server) getConfig(ctx *gin.Context) {
+	config := server.currentTunables().config
+
+	pending := make(map[string]bool)
+	for _, key := range util.RestartRequired(server.config, config) {
+		pending[key] = true
+	}
+
+	values := config.Values()
+	rsp := configResponse{Settings: make([]configSetting, len(values))}
+	for i, v := range values {
+		rsp.Settings[i] = configSetting{ConfigValue: v, PendingRestart: pending[v.Key]}
+	}
+	ctx.JSON(http.StatusOK, rsp)
 }
 
 func errorResponse(err error) gin.H {
 	return gin.H{"error": err.Error()}
 }
+
+func errorCodeResponse(code string, err error) gin.H {
+	return gin.H{"error": err.Error(), "code": code}
+}
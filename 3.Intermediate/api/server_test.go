@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+// freeAddress returns a local address nothing listens on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	server := newTestServer(t, func(config *util.Config) {
+		config.ServerAddress = freeAddress(t)
+		config.HTTPWriteTimeout = 5 * time.Second
+	})
+
+	started := make(chan struct{})
+	server.router.GET("/slow", func(ctx *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		ctx.String(http.StatusOK, "done")
+	})
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Start()
+	}()
+
+	// A connection kept alive by the client would hold up Shutdown until it
+	// counts as idle
+	transport := &http.Transport{DisableKeepAlives: true}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	url := "http://" + server.config.ServerAddress
+	for i := 0; ; i++ {
+		rsp, err := client.Post(url+"/tokens/renew", "application/json", strings.NewReader("{}"))
+		if err == nil {
+			rsp.Body.Close()
+			if rsp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("probe got %d, want 400", rsp.StatusCode)
+			}
+			break
+		}
+		if i == 50 {
+			t.Fatal("server did not start: ", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	slow := make(chan int, 1)
+	go func() {
+		rsp, err := client.Get(url + "/slow")
+		if err != nil {
+			t.Error(err)
+			slow <- 0
+			return
+		}
+		rsp.Body.Close()
+		slow <- rsp.StatusCode
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("request in flight got %d", code)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Start returned %v after Shutdown", err)
+	}
+
+	if _, err := client.Get(url + "/slow"); err == nil {
+		t.Error("server still accepts requests after Shutdown")
+	}
+}
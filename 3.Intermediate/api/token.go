@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+)
+
+var errInvalidRefreshToken = errors.New("refresh token is invalid")
+
+type tokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// issueTokens creates an access token and stores a new refresh token session
+// through q, which may be bound to a transaction.
+// A zero familyID starts a new session family, which is what login does.
+func (server *Server) issueTokens(ctx *gin.Context, q db.Queries, user db.UserResponse, familyID uuid.UUID) (tokenPair, db.Session, error) {
+	identity := token.Identity{
+		Username: user.UserName,
+		Roles:    user.Roles,
+		Scopes:   user.Scopes,
+	}
+	ttl := server.currentTunables()
+	accessToken, err := server.tokener.CreateToken(identity, ttl.accessTokenDuration)
+	if err != nil {
+		return tokenPair{}, db.Session{}, err
+	}
+
+	refreshToken, refreshHash, err := token.NewRefreshToken()
+	if err != nil {
+		return tokenPair{}, db.Session{}, err
+	}
+
+	sessionID, err := uuid.NewRandom()
+	if err != nil {
+		return tokenPair{}, db.Session{}, err
+	}
+	if familyID == uuid.Nil {
+		familyID = sessionID
+	}
+
+	session, err := q.CreateSession(ctx.Request.Context(), db.SessionRequest{
+		ID:        sessionID,
+		FamilyID:  familyID,
+		UserName:  user.UserName,
+		TokenHash: refreshHash,
+		UserAgent: ctx.Request.UserAgent(),
+		ClientIP:  server.clientIP(ctx),
+		ExpiresAt: time.Now().Add(ttl.refreshTokenDuration),
+	})
+	if err != nil {
+		return tokenPair{}, db.Session{}, err
+	}
+
+	pair := tokenPair{
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}
+	return pair, session, nil
+}
+
+type renewTokensRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// renewTokens exchanges a refresh token for a new access/refresh pair.
+// Refresh tokens are single use: presenting one that was already rotated
+// blocks every session descended from the same login.
+func (server *Server) renewTokens(ctx *gin.Context) {
+	var req renewTokensRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	session, err := server.store.GetSessionByTokenHash(ctx.Request.Context(), token.HashRefreshToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidRefreshToken))
+			return
+		}
+		ctx.JSON(storeErrorResponse(err))
+		return
+	}
+
+	if session.IsBlocked || time.Now().After(session.ExpiresAt) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidRefreshToken))
+		return
+	}
+
+	if session.ReplacedBy != nil {
+		server.blockSessionFamily(ctx, session)
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidRefreshToken))
+		return
+	}
+
+	// Load the user again so role changes show up in the renewed token
+	user, err := server.store.GetUserByUserName(ctx.Request.Context(), session.UserName)
+	if err != nil {
+		ctx.JSON(storeErrorResponse(err))
+		return
+	}
+
+	// The new session only exists if the old one could be marked as replaced
+	var pair tokenPair
+	err = server.store.ExecTx(ctx.Request.Context(), func(q db.Queries) error {
+		var next db.Session
+		var err error
+
+		pair, next, err = server.issueTokens(ctx, q, user, session.FamilyID)
+		if err != nil {
+			return err
+		}
+		return q.ReplaceSession(ctx.Request.Context(), session.ID, next.ID)
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrSessionReused) {
+			// Lost the race against another renewal with the same token
+			server.blockSessionFamily(ctx, session)
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidRefreshToken))
+			return
+		}
+		ctx.JSON(storeErrorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, pair)
+}
+
+func (server *Server) blockSessionFamily(ctx *gin.Context, session db.Session) {
+	l.W("refresh token reuse detected for user", session.UserName, "session family", session.FamilyID)
+	if err := server.store.BlockSessionFamily(ctx.Request.Context(), session.FamilyID); err != nil {
+		l.E(err)
+	}
+}
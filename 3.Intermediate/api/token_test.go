@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// Refresh tokens are single use. Reusing one ends the whole login, the
+// attacker and the victim can't be told apart.
+func TestRenewTokensReuse(t *testing.T) {
+	server := newTestServer(t)
+	createTestUser(t, server, "kai", "secret-password")
+	first := loginTestUser(t, server, "kai", "secret-password")
+	other := loginTestUser(t, server, "kai", "secret-password")
+
+	renew := func(refreshToken string) (int, tokenPair) {
+		w := serve(server, http.MethodPost, "/tokens/renew", "", renewTokensRequest{RefreshToken: refreshToken})
+		var pair tokenPair
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &pair); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, pair
+	}
+
+	code, second := renew(first.RefreshToken)
+	if code != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("renew: got %d %+v", code, second)
+	}
+	if w := serve(server, http.MethodGet, "/authUser", second.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("renewed access token: %d %s", w.Code, w.Body)
+	}
+
+	if code, _ := renew(first.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: got %d, want 401", code)
+	}
+	if code, _ := renew(second.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("newest refresh token of the blocked family: got %d, want 401", code)
+	}
+
+	if code, _ := renew(other.RefreshToken); code != http.StatusOK {
+		t.Errorf("refresh token of another login: got %d, want 200", code)
+	}
+	if code, _ := renew("not-a-refresh-token"); code != http.StatusUnauthorized {
+		t.Errorf("unknown refresh token: got %d, want 401", code)
+	}
+}
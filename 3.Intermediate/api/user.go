@@ -4,22 +4,63 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
 	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
 )
 
+type listUsersRequest struct {
+	Limit          int       `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor         string    `form:"cursor"`
+	UserNamePrefix string    `form:"user_name_prefix"`
+	EmailPrefix    string    `form:"email_prefix"`
+	CreatedAfter   time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore  time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	// Sort is a field name, with a leading "-" for descending order
+	Sort string `form:"sort" binding:"omitempty,oneof=user_name -user_name email -email created_at -created_at"`
+}
+
+type listUsersResponse struct {
+	Users []userResponse `json:"users"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// getUsers returns one page of users. Pass next_cursor back as cursor,
+// with the same filters and sort, to get the page after it.
 func (server *Server) getUsers(ctx *gin.Context) {
-	users, err := server.store.GetUsers(ctx)
-	fmt.Printf("%+v", err)
+	var req listUsersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	opts := db.ListUsersOptions{
+		Limit:          req.Limit,
+		Cursor:         req.Cursor,
+		UserNamePrefix: req.UserNamePrefix,
+		EmailPrefix:    req.EmailPrefix,
+		CreatedAfter:   req.CreatedAfter,
+		CreatedBefore:  req.CreatedBefore,
+		SortBy:         db.UserSortField(strings.TrimPrefix(req.Sort, "-")),
+		Desc:           strings.HasPrefix(req.Sort, "-"),
+	}
+
+	page, err := server.store.GetUsers(ctx.Request.Context(), opts)
 	if err != nil {
 		l.D(err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("failed to get users")))
+		ctx.JSON(storeErrorResponse(err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, users)
+	ctx.JSON(http.StatusOK, listUsersResponse{
+		Users:      newUserResponses(page.Users, viewAdmin),
+		NextCursor: page.NextCursor,
+	})
 }
 
 func (server *Server) createUser(ctx *gin.Context) {
@@ -28,44 +69,206 @@ func (server *Server) createUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	users, err := server.store.CreateUser(ctx, req)
-	fmt.Printf("%+v", err)
+	user, err := server.store.CreateUser(ctx.Request.Context(), req)
 	if err != nil {
 		l.D(err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("failed to create user")))
+		ctx.JSON(storeErrorResponse(err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, users)
+	ctx.JSON(http.StatusOK, newUserResponse(user, viewSelf))
 }
 
-//sunday work
+// importUsersRequest is capped at 100 users, every one of them costs a
+// bcrypt hash
+type importUsersRequest struct {
+	Users []db.UserRequest `json:"users" binding:"required,min=1,max=100,dive"`
+}
 
-func (server *Server) authUser(ctx *gin.Context) {
-	users, err := server.store.GetUsers(ctx)
-	fmt.Printf("%+v", err)
+type importUsersResponse struct {
+	Imported int `json:"imported"`
+}
+
+// importUsers creates users in bulk and overwrites existing users with the
+// same user name. Either all of them are imported or none. Overwritten users
+// whose password changed are logged out everywhere, like after updateUser.
+// Callers need ScopeUsersImport on top of the admin role.
+func (server *Server) importUsers(ctx *gin.Context) {
+	var req importUsersRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// bcrypt is slow, so the passwords are hashed and compared before the
+	// transaction. Users that keep their password keep their hash too, if it
+	// is still the same inside of the transaction.
+	reqCtx := ctx.Request.Context()
+	users := make([]db.UserRequest, len(req.Users))
+	unchanged := make(map[string]string)
+	for i, user := range req.Users {
+		existing, err := server.store.GetUserByUserName(reqCtx, user.UserName)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(storeErrorResponse(err))
+			return
+		}
+		if err == nil && util.CheckPassword(user.Password, existing.HashedPassword) == nil {
+			unchanged[user.UserName] = existing.HashedPassword
+		}
+
+		user.HashedPassword, err = util.HashPassword(user.Password)
+		if err != nil {
+			ctx.JSON(storeErrorResponse(err))
+			return
+		}
+		users[i] = user
+	}
+
+	var changed []string
+	err := server.store.ExecTx(reqCtx, func(q db.Queries) error {
+		changed = changed[:0]
+		for _, user := range users {
+			existing, err := q.GetUserByUserName(reqCtx, user.UserName)
+			overwrite := err == nil
+			if err != nil && !errors.Is(err, db.ErrNotFound) {
+				return fmt.Errorf("user %s: %w", user.UserName, err)
+			}
+
+			keep := overwrite && unchanged[user.UserName] == existing.HashedPassword
+			if keep {
+				user.HashedPassword = existing.HashedPassword
+			}
+			if _, err := q.UpsertUser(reqCtx, user); err != nil {
+				return fmt.Errorf("user %s: %w", user.UserName, err)
+			}
+			if overwrite && !keep {
+				if err := q.BlockUserSessions(reqCtx, user.UserName); err != nil {
+					return fmt.Errorf("user %s: %w", user.UserName, err)
+				}
+				changed = append(changed, user.UserName)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		l.D(err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(errors.New("failed to get users authUsers")))
+		ctx.JSON(storeErrorResponse(err))
+		return
+	}
+
+	if !server.revokeUserTokens(ctx, changed...) {
 		return
 	}
+	ctx.JSON(http.StatusOK, importUsersResponse{Imported: len(req.Users)})
+}
 
-	ctx.JSON(http.StatusOK, users)
+type updateUserRequest struct {
+	db.UserPatch
+	// CurrentPassword is needed to change the email or password of your own
+	// account, a stolen access token alone must not be enough to take it over
+	CurrentPassword string `json:"current_password" secret:"true"`
 }
 
-func (server *Server) ValidateToken() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		const BEARER_SCHEMA = "Bearer "
-		authHeader := c.GetHeader("Authorization")
-		tokenString := authHeader[len(BEARER_SCHEMA):]
-		_, err := server.tokener.VerifyToken(tokenString)
+// updateUser changes only the fields present in the request body.
+// A new password ends every session of the user, they have to log in again.
+func (server *Server) updateUser(ctx *gin.Context) {
+	var req updateUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	userName := ctx.Param("username")
+	// Admins too, a stolen admin token must not take over the admin account
+	payload, ok := AuthPayload(ctx)
+	self := ok && payload.Username == userName
+	if self && (req.Email != nil || req.Password != nil) {
+		if req.CurrentPassword == "" {
+			ctx.JSON(http.StatusBadRequest, errorCodeResponse(codeCurrentPasswordRequired, errCurrentPasswordRequired))
+			return
+		}
+		user, err := server.store.GetUserByUserName(reqCtx, userName)
+		if err != nil {
+			ctx.JSON(storeErrorResponse(err))
+			return
+		}
+		if err := util.CheckPassword(req.CurrentPassword, user.HashedPassword); err != nil {
+			ctx.JSON(http.StatusForbidden, errorCodeResponse(codeInvalidCredentials, errWrongCurrentPassword))
+			return
+		}
+	}
+
+	// bcrypt is slow, hash before the transaction instead of inside of it
+	if req.Password != nil {
+		passHash, err := util.HashPassword(*req.Password)
+		if err != nil {
+			ctx.JSON(storeErrorResponse(err))
+			return
+		}
+		req.HashedPassword = &passHash
+	}
+
+	var user db.UserResponse
+	err := server.store.ExecTx(reqCtx, func(q db.Queries) error {
+		var err error
+		user, err = q.UpdateUser(reqCtx, userName, req.UserPatch)
+		if err != nil || req.Password == nil {
+			return err
+		}
+		return q.BlockUserSessions(reqCtx, userName)
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, errorCodeResponse(codeUserNotFound, errUserNotFound))
+			return
+		}
+		ctx.JSON(storeErrorResponse(err))
+		return
+	}
+
+	if req.Password != nil && !server.revokeUserTokens(ctx, userName) {
+		return
+	}
 
+	ctx.JSON(http.StatusOK, newUserResponse(user, viewFor(ctx, user.UserName)))
+}
+
+// revokeUserTokens rejects every access token issued to the users so far.
+// It answers the request itself when that fails, and returns false.
+func (server *Server) revokeUserTokens(ctx *gin.Context, userNames ...string) bool {
+	// Access tokens are not stored, so they are rejected by issue time until
+	// the longest of them has expired. iat only has whole seconds, so the
+	// cutoff does too, or a login right after this would be rejected as well.
+	// A token issued earlier in the same second stays valid.
+	now := time.Now().Truncate(time.Second)
+	ttl := server.currentTunables().accessTokenDuration
+	for _, userName := range userNames {
+		err := server.revoker.RevokeUserTokens(ctx.Request.Context(), userName, now, now.Add(ttl))
 		if err != nil {
-			fmt.Println("------------------------------")
-			c.JSON(http.StatusForbidden, errorResponse(errors.New("Not allowed")))
-			c.AbortWithStatus(http.StatusUnauthorized)
+			ctx.JSON(storeErrorResponse(err))
+			return false
 		}
+	}
+	return true
+}
 
-		// server.tokener.VerifyToken(tokenString)
+// authUser returns the user the access token was issued for
+func (server *Server) authUser(ctx *gin.Context) {
+	payload, ok := AuthPayload(ctx)
+	if !ok {
+		abortUnauthorized(ctx, errAuthRequired)
+		return
+	}
+
+	user, err := server.store.GetUserByUserName(ctx.Request.Context(), payload.Username)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, errorCodeResponse(codeUserNotFound, errUserNotFound))
+			return
+		}
+		ctx.JSON(storeErrorResponse(err))
+		return
 	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user, viewFor(ctx, user.UserName)))
 }
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/token"
+)
+
+// Changing the email or password of your own account needs the current
+// password, and a new password ends every session
+func TestUpdateUserCredentials(t *testing.T) {
+	server := newTestServer(t)
+	createTestUser(t, server, "erin", "secret-password")
+
+	session := loginTestUser(t, server, "erin", "secret-password")
+
+	tests := []struct {
+		name   string
+		body   gin.H
+		status int
+		code   string
+	}{
+		{"email without current password", gin.H{"email": "new@example.com"}, http.StatusBadRequest, codeCurrentPasswordRequired},
+		{"password without current password", gin.H{"password": "new-password"}, http.StatusBadRequest, codeCurrentPasswordRequired},
+		{"wrong current password", gin.H{"password": "new-password", "current_password": "guess"}, http.StatusForbidden, codeInvalidCredentials},
+		{"name only", gin.H{"first_name": "Erika"}, http.StatusOK, ""},
+		{"email", gin.H{"email": "new@example.com", "current_password": "secret-password"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := serve(server, http.MethodPatch, "/users/erin", session.AccessToken, tt.body)
+		wantErrorCode(t, tt.name, w, tt.status, tt.code)
+	}
+
+	// Nothing changed the password so far, the session is still good
+	if w := serve(server, http.MethodGet, "/authUser", session.AccessToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("before the password change: %d %s", w.Code, w.Body)
+	}
+
+	nextSecond()
+	w := serve(server, http.MethodPatch, "/users/erin", session.AccessToken, gin.H{"password": "new-password", "current_password": "secret-password"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("password change: %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(server, http.MethodGet, "/authUser", session.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("old access token: got %d, want 401", w.Code)
+	}
+	w = serve(server, http.MethodPost, "/tokens/renew", "", renewTokensRequest{RefreshToken: session.RefreshToken})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("old refresh token: got %d, want 401", w.Code)
+	}
+
+	// Logging in again works right away
+	session = loginTestUser(t, server, "erin", "new-password")
+	if w := serve(server, http.MethodGet, "/authUser", session.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("new access token: %d %s", w.Code, w.Body)
+	}
+
+	// Admins can reset other users without knowing their password
+	admin := testAccessToken(t, server, token.Identity{Username: "root", Roles: []string{RoleAdmin}})
+	nextSecond()
+	if w := serve(server, http.MethodPatch, "/users/erin", admin, gin.H{"password": "reset-password"}); w.Code != http.StatusOK {
+		t.Errorf("admin reset: %d %s", w.Code, w.Body)
+	}
+	if w := serve(server, http.MethodGet, "/authUser", session.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after the admin reset: got %d, want 401", w.Code)
+	}
+	loginTestUser(t, server, "erin", "reset-password")
+
+	// Their own account needs the current password like everyone else's
+	createTestUser(t, server, "root", "root-password")
+	for name, body := range map[string]gin.H{
+		"admin password": {"password": "taken-over"},
+		"admin email":    {"email": "attacker@example.com"},
+	} {
+		w := serve(server, http.MethodPatch, "/users/root", admin, body)
+		wantErrorCode(t, name, w, http.StatusBadRequest, codeCurrentPasswordRequired)
+	}
+	w = serve(server, http.MethodPatch, "/users/root", admin, gin.H{"password": "new-root-password", "current_password": "root-password"})
+	if w.Code != http.StatusOK {
+		t.Errorf("admin password change: %d %s", w.Code, w.Body)
+	}
+	loginTestUser(t, server, "root", "new-root-password")
+}
+
+// An import that overwrites a password ends the sessions of that user, one
+// that keeps the password leaves them alone
+func TestImportUsersEndsSessions(t *testing.T) {
+	server := newTestServer(t)
+	createTestUser(t, server, "fay", "secret-password")
+	createTestUser(t, server, "hal", "secret-password")
+	fay := loginTestUser(t, server, "fay", "secret-password")
+	hal := loginTestUser(t, server, "hal", "secret-password")
+
+	user := func(userName string, password string) db.UserRequest {
+		return db.UserRequest{
+			UserName:  userName,
+			Email:     userName + "@example.com",
+			Password:  password,
+			FirstName: userName,
+			LastName:  "Imported",
+		}
+	}
+	admin := testAccessToken(t, server, token.Identity{Username: "root", Roles: []string{RoleAdmin}, Scopes: []string{ScopeUsersImport}})
+	nextSecond()
+	w := serve(server, http.MethodPost, "/users/import", admin, importUsersRequest{Users: []db.UserRequest{
+		user("fay", "imported-password"),
+		user("hal", "secret-password"),
+		user("ivy", "new-user-password"),
+	}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(server, http.MethodGet, "/authUser", fay.AccessToken, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token of an overwritten password: got %d, want 401", w.Code)
+	}
+	w = serve(server, http.MethodPost, "/tokens/renew", "", renewTokensRequest{RefreshToken: fay.RefreshToken})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of an overwritten password: got %d, want 401", w.Code)
+	}
+	loginTestUser(t, server, "fay", "imported-password")
+
+	if w := serve(server, http.MethodGet, "/authUser", hal.AccessToken, nil); w.Code != http.StatusOK {
+		t.Errorf("access token of an unchanged password: %d %s", w.Code, w.Body)
+	}
+	w = serve(server, http.MethodPost, "/tokens/renew", "", renewTokensRequest{RefreshToken: hal.RefreshToken})
+	if w.Code != http.StatusOK {
+		t.Errorf("refresh token of an unchanged password: %d %s", w.Code, w.Body)
+	}
+	loginTestUser(t, server, "ivy", "new-user-password")
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+)
+
+// userView decides how much of a user the caller gets to see
+type userView int
+
+const (
+	// viewPublic is what anyone may know about a user
+	viewPublic userView = iota
+	// viewSelf adds the contact details, for the user themselves
+	viewSelf
+	// viewAdmin adds roles and scopes
+	viewAdmin
+)
+
+// userResponse is a user as the API sends it. db.UserResponse is the
+// stored record and never goes to the client as is. Fields that the view
+// leaves out are omitted.
+type userResponse struct {
+	UserName  string     `json:"user_name"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Roles     []string   `json:"roles,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+}
+
+func newUserResponse(user db.UserResponse, view userView) userResponse {
+	rsp := userResponse{
+		UserName:  user.UserName,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+	if view >= viewSelf {
+		createdAt := user.CreatedAt
+		rsp.Email = user.Email
+		rsp.CreatedAt = &createdAt
+	}
+	if view >= viewAdmin {
+		rsp.Roles = user.Roles
+		rsp.Scopes = user.Scopes
+	}
+	return rsp
+}
+
+func newUserResponses(users []db.UserResponse, view userView) []userResponse {
+	rsp := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		rsp = append(rsp, newUserResponse(user, view))
+	}
+	return rsp
+}
+
+// viewFor returns the view the caller of the request has on userName
+func viewFor(ctx *gin.Context, userName string) userView {
+	payload, ok := AuthPayload(ctx)
+	switch {
+	case !ok:
+		return viewPublic
+	case payload.HasRole(RoleAdmin):
+		return viewAdmin
+	case payload.Username == userName:
+		return viewSelf
+	}
+	return viewPublic
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+const configUsage = `usage: app config <command>
+
+  print  show the effective config and where each value came from,
+         with secrets masked`
+
+var errConfigUsage = errors.New(configUsage)
+
+// runConfig runs the config subcommand. It works on configs that do not
+// validate, to help fixing them.
+func runConfig(config util.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errConfigUsage
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, v := range config.Values() {
+		fmt.Fprintf(w, "%s=%s\t# %s\n", v.Key, v.Value, v.Source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return nil
+}
@@ -2,25 +2,88 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // Store ...
 type Store interface {
+	Queries
+	Transactor
+	// Close releases whatever the store holds on to, like database connections
+	Close()
+}
+
+// Queries is everything a Store can do, inside or outside of a transaction
+type Queries interface {
 	UserGetter
 	UserUpdater
 	UserCreator
+	UserImporter
+	SessionStore
+	TokenRevoker
+}
+
+// Transactor runs a unit of work atomically. fn gets a Queries bound to the
+// transaction; when fn returns an error everything it did is rolled back.
+// fn may run more than once, so it must not have side effects outside of q.
+type Transactor interface {
+	// ExecTx runs fn with DefaultTxOptions
+	ExecTx(ctx context.Context, fn func(q Queries) error) error
+	ExecTxOptions(ctx context.Context, opts TxOptions, fn func(q Queries) error) error
 }
 
 type UserGetter interface {
 	GetUserByEmail(ctx context.Context, email string) (UserResponse, error)
 	GetUserByUserName(ctx context.Context, userName string) (UserResponse, error)
-	GetUsers(ctx context.Context) ([]UserResponse, error)
+	// GetUsers returns one page of users, without their password hashes
+	GetUsers(ctx context.Context, opts ListUsersOptions) (UserPage, error)
 }
 
 type UserCreator interface {
+	// CreateUser returns ErrDuplicateUserName or ErrDuplicateEmail
+	// instead of touching an existing user
 	CreateUser(ctx context.Context, user UserRequest) (UserResponse, error)
 }
 
+// UserImporter is for bulk provisioning by admins, not for sign ups
+type UserImporter interface {
+	// UpsertUser creates the user or overwrites the one with the same user name
+	UpsertUser(ctx context.Context, user UserRequest) (UserResponse, error)
+}
+
 type UserUpdater interface {
-	UpdateUser(ctx context.Context, user UserRequest) (UserResponse, error)
+	// UpdateUser changes only the fields set in patch. It returns
+	// ErrNotFound for unknown users.
+	UpdateUser(ctx context.Context, userName string, patch UserPatch) (UserResponse, error)
+}
+
+// SessionStore keeps track of the refresh tokens handed out at login
+type SessionStore interface {
+	CreateSession(ctx context.Context, session SessionRequest) (Session, error)
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (Session, error)
+	// ReplaceSession marks a session as used by pointing it at its successor.
+	// It returns ErrSessionReused when the session was already replaced or blocked.
+	ReplaceSession(ctx context.Context, id uuid.UUID, replacedBy uuid.UUID) error
+	BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error
+	// BlockUserSessions blocks every session of the user, e.g. after a
+	// password change
+	BlockUserSessions(ctx context.Context, userName string) error
+}
+
+// TokenRevoker keeps the ids of access tokens that must no longer be accepted.
+// Entries are only needed until the token would have expired anyway.
+type TokenRevoker interface {
+	RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error
+	// RevokeUserTokens revokes every token issued to userName before the
+	// given time. The entry is kept until expiresAt, when the last of those
+	// tokens has expired.
+	RevokeUserTokens(ctx context.Context, userName string, before time.Time, expiresAt time.Time) error
+	// IsTokenRevoked reports whether the token id, issued to userName at
+	// issuedAt, was revoked on its own or with all tokens of the user
+	IsTokenRevoked(ctx context.Context, id uuid.UUID, userName string, issuedAt time.Time) (bool, error)
+	// PruneRevokedTokens deletes entries that expired before the given time.
+	// The count covers both single tokens and users.
+	PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error)
 }
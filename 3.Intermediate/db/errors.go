@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrNotFound means the record asked for does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicateEmail means another user already has this email
+	ErrDuplicateEmail = errors.New("email is already taken")
+	// ErrDuplicateUserName means another user already has this user name
+	ErrDuplicateUserName = errors.New("user name is already taken")
+	// ErrConstraintViolation matches every *ConstraintError with errors.Is
+	ErrConstraintViolation = errors.New("constraint violation")
+
+	// ErrQueryCanceled means the caller went away before the query finished
+	ErrQueryCanceled = errors.New("query canceled")
+	// ErrQueryTimeout means the query ran past the deadline of its context
+	ErrQueryTimeout = errors.New("query timed out")
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	// every integrity constraint violation starts with this class
+	pgIntegrityConstraintClass = "23"
+)
+
+// Constraint names from the migrations that map to their own error
+const (
+	usersPrimaryKey = "users_pkey"
+	usersEmailKey   = "users_email_key"
+)
+
+// ConstraintError is a violated database constraint that has no more
+// specific error of its own
+type ConstraintError struct {
+	Code       string
+	Table      string
+	Constraint string
+	Message    string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConstraintViolation, e.Message)
+}
+
+// Is makes errors.Is(err, ErrConstraintViolation) work
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// pgError translates errors coming out of pgx into the errors of this
+// package. pgx does not always report a cancelled query as a context error
+// (it may surface as a network timeout), so the context itself decides.
+func pgError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := contextError(ctx, err); ctxErr != nil {
+		return ctxErr
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || len(pgErr.Code) < 2 || pgErr.Code[:2] != pgIntegrityConstraintClass {
+		return err
+	}
+
+	if pgErr.Code == pgUniqueViolation {
+		switch pgErr.ConstraintName {
+		case usersPrimaryKey:
+			return ErrDuplicateUserName
+		case usersEmailKey:
+			return ErrDuplicateEmail
+		}
+	}
+
+	return &ConstraintError{
+		Code:       pgErr.Code,
+		Table:      pgErr.TableName,
+		Constraint: pgErr.ConstraintName,
+		Message:    pgErr.Message,
+	}
+}
+
+// contextError wraps err in ErrQueryTimeout or ErrQueryCanceled when ctx is
+// done, and returns nil otherwise
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+	case context.Canceled:
+		return fmt.Errorf("%w: %v", ErrQueryCanceled, err)
+	}
+	return nil
+}
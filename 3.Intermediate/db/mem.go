@@ -0,0 +1,621 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemStore is an in-memory Store. It mirrors what PGStore does, including
+// the errors it returns, so it can stand in for Postgres in tests and
+// local development.
+//
+// Transactions copy a table on their first write to it, and the copies
+// replace the originals on commit. They hold the write lock while they run,
+// which makes them serializable whatever IsoLevel is asked for, and they
+// never need a retry.
+type MemStore struct {
+	mu   sync.RWMutex
+	data *memData
+}
+
+type memData struct {
+	users        map[string]UserResponse
+	sessions     map[uuid.UUID]Session
+	revoked      map[uuid.UUID]time.Time
+	revokedUsers map[string]userRevocation
+	// shared are the tables a transaction has not copied yet
+	shared memTable
+}
+
+// memTable is a set of the tables in memData
+type memTable uint8
+
+const (
+	memUsers memTable = 1 << iota
+	memSessions
+	memRevoked
+	memRevokedUsers
+
+	memAllTables = memUsers | memSessions | memRevoked | memRevokedUsers
+)
+
+// userRevocation rejects the tokens of a user issued before a point in
+// time, see RevokeUserTokens
+type userRevocation struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+func (r userRevocation) merge(other userRevocation) userRevocation {
+	if other.before.After(r.before) {
+		r.before = other.before
+	}
+	if other.expiresAt.After(r.expiresAt) {
+		r.expiresAt = other.expiresAt
+	}
+	return r
+}
+
+// NewMemStore ...
+func NewMemStore() Store {
+	return &MemStore{
+		data: &memData{
+			users:        make(map[string]UserResponse),
+			sessions:     make(map[uuid.UUID]Session),
+			revoked:      make(map[uuid.UUID]time.Time),
+			revokedUsers: make(map[string]userRevocation),
+		},
+	}
+}
+
+// snapshot returns the data for a transaction, sharing every table with d
+// until the transaction writes to it
+func (d *memData) snapshot() *memData {
+	tx := *d
+	tx.shared = memAllTables
+	return &tx
+}
+
+// own copies table before its first write in a transaction. Records are
+// replaced and never modified in place, so copying the structs is enough.
+func (d *memData) own(table memTable) {
+	if d.shared&table == 0 {
+		return
+	}
+	d.shared &^= table
+
+	switch table {
+	case memUsers:
+		users := make(map[string]UserResponse, len(d.users))
+		for k, v := range d.users {
+			users[k] = v
+		}
+		d.users = users
+	case memSessions:
+		sessions := make(map[uuid.UUID]Session, len(d.sessions))
+		for k, v := range d.sessions {
+			sessions[k] = v
+		}
+		d.sessions = sessions
+	case memRevoked:
+		revoked := make(map[uuid.UUID]time.Time, len(d.revoked))
+		for k, v := range d.revoked {
+			revoked[k] = v
+		}
+		d.revoked = revoked
+	case memRevokedUsers:
+		revokedUsers := make(map[string]userRevocation, len(d.revokedUsers))
+		for k, v := range d.revokedUsers {
+			revokedUsers[k] = v
+		}
+		d.revokedUsers = revokedUsers
+	}
+}
+
+// Close implements Store, there is nothing to release
+func (m *MemStore) Close() {}
+
+// read runs fn under the read lock
+func (m *MemStore) read(fn func(q *memQueries) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fn(&memQueries{data: m.data})
+}
+
+// write runs fn under the write lock
+func (m *MemStore) write(fn func(q *memQueries) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn(&memQueries{data: m.data})
+}
+
+// ExecTx ..
+func (m *MemStore) ExecTx(ctx context.Context, fn func(q Queries) error) error {
+	return m.ExecTxOptions(ctx, DefaultTxOptions, fn)
+}
+
+// ExecTxOptions ..
+func (m *MemStore) ExecTxOptions(ctx context.Context, opts TxOptions, fn func(q Queries) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	tx := m.data.snapshot()
+	if err := fn(&memQueries{data: tx}); err != nil {
+		return err
+	}
+
+	// Like a Postgres commit, a transaction whose context is done is rolled back
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	tx.shared = 0
+	m.data = tx
+	return nil
+}
+
+// GetUserByUserName ..
+func (m *MemStore) GetUserByUserName(ctx context.Context, userName string) (ur UserResponse, err error) {
+	err = m.read(func(q *memQueries) error {
+		ur, err = q.GetUserByUserName(ctx, userName)
+		return err
+	})
+	return ur, err
+}
+
+// GetUserByEmail ..
+func (m *MemStore) GetUserByEmail(ctx context.Context, email string) (ur UserResponse, err error) {
+	err = m.read(func(q *memQueries) error {
+		ur, err = q.GetUserByEmail(ctx, email)
+		return err
+	})
+	return ur, err
+}
+
+// GetUsers ..
+func (m *MemStore) GetUsers(ctx context.Context, opts ListUsersOptions) (page UserPage, err error) {
+	err = m.read(func(q *memQueries) error {
+		page, err = q.GetUsers(ctx, opts)
+		return err
+	})
+	return page, err
+}
+
+// CreateUser ..
+func (m *MemStore) CreateUser(ctx context.Context, user UserRequest) (ur UserResponse, err error) {
+	// Hash outside of the lock, bcrypt is slow on purpose
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	err = m.write(func(q *memQueries) error {
+		ur, err = q.putUser(ctx, user, passHash, false)
+		return err
+	})
+	return ur, err
+}
+
+// UpsertUser ..
+func (m *MemStore) UpsertUser(ctx context.Context, user UserRequest) (ur UserResponse, err error) {
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	err = m.write(func(q *memQueries) error {
+		ur, err = q.putUser(ctx, user, passHash, true)
+		return err
+	})
+	return ur, err
+}
+
+// UpdateUser ..
+func (m *MemStore) UpdateUser(ctx context.Context, userName string, patch UserPatch) (ur UserResponse, err error) {
+	// Hash outside of the lock, like CreateUser
+	passHash, err := patch.hashPassword()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	err = m.write(func(q *memQueries) error {
+		ur, err = q.updateUser(ctx, userName, patch, passHash)
+		return err
+	})
+	return ur, err
+}
+
+// CreateSession ..
+func (m *MemStore) CreateSession(ctx context.Context, session SessionRequest) (s Session, err error) {
+	err = m.write(func(q *memQueries) error {
+		s, err = q.CreateSession(ctx, session)
+		return err
+	})
+	return s, err
+}
+
+// GetSessionByTokenHash ..
+func (m *MemStore) GetSessionByTokenHash(ctx context.Context, tokenHash string) (s Session, err error) {
+	err = m.read(func(q *memQueries) error {
+		s, err = q.GetSessionByTokenHash(ctx, tokenHash)
+		return err
+	})
+	return s, err
+}
+
+// ReplaceSession ..
+func (m *MemStore) ReplaceSession(ctx context.Context, id uuid.UUID, replacedBy uuid.UUID) error {
+	return m.write(func(q *memQueries) error {
+		return q.ReplaceSession(ctx, id, replacedBy)
+	})
+}
+
+// BlockSessionFamily ..
+func (m *MemStore) BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error {
+	return m.write(func(q *memQueries) error {
+		return q.BlockSessionFamily(ctx, familyID)
+	})
+}
+
+// BlockUserSessions ..
+func (m *MemStore) BlockUserSessions(ctx context.Context, userName string) error {
+	return m.write(func(q *memQueries) error {
+		return q.BlockUserSessions(ctx, userName)
+	})
+}
+
+// RevokeToken ..
+func (m *MemStore) RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	return m.write(func(q *memQueries) error {
+		return q.RevokeToken(ctx, id, expiresAt)
+	})
+}
+
+// RevokeUserTokens ..
+func (m *MemStore) RevokeUserTokens(ctx context.Context, userName string, before time.Time, expiresAt time.Time) error {
+	return m.write(func(q *memQueries) error {
+		return q.RevokeUserTokens(ctx, userName, before, expiresAt)
+	})
+}
+
+// IsTokenRevoked ..
+func (m *MemStore) IsTokenRevoked(ctx context.Context, id uuid.UUID, userName string, issuedAt time.Time) (revoked bool, err error) {
+	err = m.read(func(q *memQueries) error {
+		revoked, err = q.IsTokenRevoked(ctx, id, userName, issuedAt)
+		return err
+	})
+	return revoked, err
+}
+
+// PruneRevokedTokens ..
+func (m *MemStore) PruneRevokedTokens(ctx context.Context, before time.Time) (n int64, err error) {
+	err = m.write(func(q *memQueries) error {
+		n, err = q.PruneRevokedTokens(ctx, before)
+		return err
+	})
+	return n, err
+}
+
+// memQueries implements Queries on top of memData without any locking.
+// MemStore takes care of that, or the transaction owns the data outright.
+type memQueries struct {
+	data *memData
+}
+
+func (q *memQueries) GetUserByUserName(ctx context.Context, userName string) (UserResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return UserResponse{}, pgError(ctx, err)
+	}
+
+	ur, ok := q.data.users[userName]
+	if !ok {
+		return UserResponse{}, ErrNotFound
+	}
+	return ur, nil
+}
+
+func (q *memQueries) GetUserByEmail(ctx context.Context, email string) (UserResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return UserResponse{}, pgError(ctx, err)
+	}
+
+	for _, ur := range q.data.users {
+		if ur.Email == email {
+			ur.HashedPassword = ""
+			return ur, nil
+		}
+	}
+	return UserResponse{}, ErrNotFound
+}
+
+func (q *memQueries) GetUsers(ctx context.Context, opts ListUsersOptions) (UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return UserPage{}, pgError(ctx, err)
+	}
+
+	list, err := newUserListQuery(opts)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	var users = make([]UserResponse, 0)
+	for _, ur := range q.data.users {
+		if list.match(ur) {
+			ur.HashedPassword = ""
+			users = append(users, ur)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return list.less(users[i], users[j])
+	})
+	if len(users) > list.Limit+1 {
+		users = users[:list.Limit+1]
+	}
+	return list.page(users), nil
+}
+
+func (q *memQueries) CreateUser(ctx context.Context, user UserRequest) (UserResponse, error) {
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
+	return q.putUser(ctx, user, passHash, false)
+}
+
+func (q *memQueries) UpsertUser(ctx context.Context, user UserRequest) (UserResponse, error) {
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
+	return q.putUser(ctx, user, passHash, true)
+}
+
+// putUser inserts a user. An existing user with the same user name is
+// overwritten when upsert is set, and is a conflict otherwise.
+func (q *memQueries) putUser(ctx context.Context, user UserRequest, passHash string, upsert bool) (UserResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return UserResponse{}, pgError(ctx, err)
+	}
+
+	ur, ok := q.data.users[user.UserName]
+	if ok && !upsert {
+		return UserResponse{}, ErrDuplicateUserName
+	}
+	if err := q.checkEmail(user.UserName, user.Email); err != nil {
+		return UserResponse{}, err
+	}
+
+	if !ok {
+		ur = UserResponse{UserName: user.UserName, Roles: []string{}, Scopes: []string{}, CreatedAt: time.Now()}
+	}
+	ur.FirstName = user.FirstName
+	ur.LastName = user.LastName
+	ur.Email = user.Email
+	ur.HashedPassword = passHash
+	q.data.own(memUsers)
+	q.data.users[user.UserName] = ur
+
+	ur.HashedPassword = ""
+	return ur, nil
+}
+
+func (q *memQueries) UpdateUser(ctx context.Context, userName string, patch UserPatch) (UserResponse, error) {
+	passHash, err := patch.hashPassword()
+	if err != nil {
+		return UserResponse{}, err
+	}
+	return q.updateUser(ctx, userName, patch, passHash)
+}
+
+func (q *memQueries) updateUser(ctx context.Context, userName string, patch UserPatch, passHash *string) (UserResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return UserResponse{}, pgError(ctx, err)
+	}
+
+	ur, ok := q.data.users[userName]
+	if !ok {
+		return UserResponse{}, ErrNotFound
+	}
+
+	if patch.FirstName != nil {
+		ur.FirstName = *patch.FirstName
+	}
+	if patch.LastName != nil {
+		ur.LastName = *patch.LastName
+	}
+	if patch.Email != nil {
+		if err := q.checkEmail(userName, *patch.Email); err != nil {
+			return UserResponse{}, err
+		}
+		ur.Email = *patch.Email
+	}
+	if passHash != nil {
+		ur.HashedPassword = *passHash
+	}
+	q.data.own(memUsers)
+	q.data.users[userName] = ur
+
+	ur.HashedPassword = ""
+	return ur, nil
+}
+
+// checkEmail enforces unique(email) from the users table
+func (q *memQueries) checkEmail(userName string, email string) error {
+	for _, other := range q.data.users {
+		if other.Email == email && other.UserName != userName {
+			return ErrDuplicateEmail
+		}
+	}
+	return nil
+}
+
+func (q *memQueries) CreateSession(ctx context.Context, session SessionRequest) (Session, error) {
+	if err := ctx.Err(); err != nil {
+		return Session{}, pgError(ctx, err)
+	}
+	if _, ok := q.data.users[session.UserName]; !ok {
+		return Session{}, &ConstraintError{
+			Code:       pgForeignKeyViolation,
+			Table:      "sessions",
+			Constraint: "sessions_user_name_fkey",
+			Message:    `insert or update on table "sessions" violates foreign key constraint "sessions_user_name_fkey"`,
+		}
+	}
+	if _, ok := q.data.sessions[session.ID]; ok {
+		return Session{}, uniqueViolation("sessions", "sessions_pkey")
+	}
+	for _, other := range q.data.sessions {
+		if other.TokenHash == session.TokenHash {
+			return Session{}, uniqueViolation("sessions", "sessions_token_hash_key")
+		}
+	}
+
+	s := Session{
+		ID:        session.ID,
+		FamilyID:  session.FamilyID,
+		UserName:  session.UserName,
+		TokenHash: session.TokenHash,
+		UserAgent: session.UserAgent,
+		ClientIP:  session.ClientIP,
+		ExpiresAt: session.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	q.data.own(memSessions)
+	q.data.sessions[s.ID] = s
+	return s, nil
+}
+
+func (q *memQueries) GetSessionByTokenHash(ctx context.Context, tokenHash string) (Session, error) {
+	if err := ctx.Err(); err != nil {
+		return Session{}, pgError(ctx, err)
+	}
+
+	for _, s := range q.data.sessions {
+		if s.TokenHash == tokenHash {
+			return s, nil
+		}
+	}
+	return Session{}, ErrNotFound
+}
+
+func (q *memQueries) ReplaceSession(ctx context.Context, id uuid.UUID, replacedBy uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	s, ok := q.data.sessions[id]
+	if !ok || s.ReplacedBy != nil || s.IsBlocked {
+		return ErrSessionReused
+	}
+	s.ReplacedBy = &replacedBy
+	q.data.own(memSessions)
+	q.data.sessions[id] = s
+	return nil
+}
+
+func (q *memQueries) BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	q.data.own(memSessions)
+	for id, s := range q.data.sessions {
+		if s.FamilyID == familyID {
+			s.IsBlocked = true
+			q.data.sessions[id] = s
+		}
+	}
+	return nil
+}
+
+func (q *memQueries) BlockUserSessions(ctx context.Context, userName string) error {
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	q.data.own(memSessions)
+	for id, s := range q.data.sessions {
+		if s.UserName == userName {
+			s.IsBlocked = true
+			q.data.sessions[id] = s
+		}
+	}
+	return nil
+}
+
+func (q *memQueries) RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	if _, ok := q.data.revoked[id]; !ok {
+		q.data.own(memRevoked)
+		q.data.revoked[id] = expiresAt
+	}
+	return nil
+}
+
+func (q *memQueries) RevokeUserTokens(ctx context.Context, userName string, before time.Time, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return pgError(ctx, err)
+	}
+
+	r := userRevocation{before: before, expiresAt: expiresAt}
+	q.data.own(memRevokedUsers)
+	q.data.revokedUsers[userName] = q.data.revokedUsers[userName].merge(r)
+	return nil
+}
+
+func (q *memQueries) IsTokenRevoked(ctx context.Context, id uuid.UUID, userName string, issuedAt time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, pgError(ctx, err)
+	}
+
+	if _, ok := q.data.revoked[id]; ok {
+		return true, nil
+	}
+	r, ok := q.data.revokedUsers[userName]
+	return ok && r.before.After(issuedAt), nil
+}
+
+func (q *memQueries) PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, pgError(ctx, err)
+	}
+
+	q.data.own(memRevoked)
+	q.data.own(memRevokedUsers)
+
+	var n int64
+	for id, expiresAt := range q.data.revoked {
+		if expiresAt.Before(before) {
+			delete(q.data.revoked, id)
+			n++
+		}
+	}
+	for userName, r := range q.data.revokedUsers {
+		if r.expiresAt.Before(before) {
+			delete(q.data.revokedUsers, userName)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func uniqueViolation(table string, constraint string) *ConstraintError {
+	return &ConstraintError{
+		Code:       pgUniqueViolation,
+		Table:      table,
+		Constraint: constraint,
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	// ErrSchemaAhead means the database has migrations that this build does
+	// not know about, it was most likely migrated by a newer release
+	ErrSchemaAhead = errors.New("database schema is newer than this build")
+	// ErrSchemaDirty means a migration failed halfway, see PGMigrator.Force
+	ErrSchemaDirty = errors.New("database schema is dirty")
+)
+
+// migration is one step of a migration set laid out the way golang-migrate
+// expects it: {version}_{name}.up.sql and {version}_{name}.down.sql
+type migration struct {
+	version uint
+	name    string
+	up      string
+	down    string
+}
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// loadMigrations reads every migration in the root of fsys, sorted by version
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*migration)
+	for _, f := range files {
+		m := migrationFileRe.FindStringSubmatch(f.Name())
+		if f.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", f.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[uint(version)]
+		if !ok {
+			mig = &migration{version: uint(version), name: m[2]}
+			byVersion[uint(version)] = mig
+		}
+		if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.up = string(body)
+		} else {
+			mig.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.version, mig.name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
@@ -0,0 +1,16 @@
+create table if not exists sessions (
+	id uuid primary key,
+	family_id uuid not null,
+	user_name varchar not null references users (user_name) on delete cascade,
+	token_hash varchar not null,
+	user_agent varchar not null,
+	client_ip varchar not null,
+	is_blocked boolean not null default false,
+	replaced_by uuid,
+	expires_at timestamptz not null,
+	created_at timestamptz not null DEFAULT (now()),
+
+	unique(token_hash)
+);
+
+create index if not exists sessions_family_id_idx on sessions (family_id);
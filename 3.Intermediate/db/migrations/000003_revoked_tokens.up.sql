@@ -0,0 +1,7 @@
+create table if not exists revoked_tokens (
+	id uuid primary key,
+	expires_at timestamptz not null,
+	revoked_at timestamptz not null DEFAULT (now())
+);
+
+create index if not exists revoked_tokens_expires_at_idx on revoked_tokens (expires_at);
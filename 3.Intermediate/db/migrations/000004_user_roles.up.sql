@@ -0,0 +1,3 @@
+alter table users
+	add column if not exists roles varchar[] not null DEFAULT '{}',
+	add column if not exists scopes varchar[] not null DEFAULT '{}';
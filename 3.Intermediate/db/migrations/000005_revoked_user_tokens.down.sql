@@ -0,0 +1 @@
+drop table if exists revoked_user_tokens;
\ No newline at end of file
@@ -0,0 +1,10 @@
+create table if not exists users (
+	user_name varchar primary key,
+	first_name varchar(40) not null,
+	last_name varchar(40) not null,
+	email varchar not null,
+	pass_hash varchar not null,
+	created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+	unique(email)
+);
@@ -0,0 +1,16 @@
+create table if not exists sessions (
+	id varchar primary key,
+	family_id varchar not null,
+	user_name varchar not null references users (user_name) on delete cascade,
+	token_hash varchar not null,
+	user_agent varchar not null,
+	client_ip varchar not null,
+	is_blocked boolean not null default false,
+	replaced_by varchar,
+	expires_at timestamp not null,
+	created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+	unique(token_hash)
+);
+
+create index if not exists sessions_family_id_idx on sessions (family_id);
@@ -0,0 +1,7 @@
+create table if not exists revoked_tokens (
+	id varchar primary key,
+	expires_at timestamp not null,
+	revoked_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index if not exists revoked_tokens_expires_at_idx on revoked_tokens (expires_at);
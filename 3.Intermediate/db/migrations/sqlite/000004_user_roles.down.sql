@@ -0,0 +1,2 @@
+alter table users drop column scopes;
+alter table users drop column roles;
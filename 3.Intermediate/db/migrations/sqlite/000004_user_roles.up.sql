@@ -0,0 +1,3 @@
+-- SQLite has no arrays, roles and scopes are JSON arrays of strings
+alter table users add column roles varchar not null default '[]';
+alter table users add column scopes varchar not null default '[]';
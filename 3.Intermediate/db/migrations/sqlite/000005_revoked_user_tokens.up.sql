@@ -0,0 +1,7 @@
+create table if not exists revoked_user_tokens (
+	user_name varchar primary key,
+	revoked_before timestamp not null,
+	expires_at timestamp not null
+);
+
+create index if not exists revoked_user_tokens_expires_at_idx on revoked_user_tokens (expires_at);
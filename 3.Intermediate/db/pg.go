@@ -1,17 +1,107 @@
 package db
 
 import (
+	"context"
+	"time"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// dbtx is what the queries need, both *pgxpool.Pool and pgx.Tx provide it
+type dbtx interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
 // PGStore ...
 type PGStore struct {
-	db *pgx.Conn
+	db dbtx
+	// pool is nil for a PGStore bound to a transaction
+	pool *pgxpool.Pool
 }
 
 // NewPGStore creates PGStore that implements the 'Store' interface
-func NewPGStore(db *pgx.Conn) Store {
+func NewPGStore(db *pgxpool.Pool) Store {
 	return &PGStore{
-		db: db,
+		db:   db,
+		pool: db,
+	}
+}
+
+// Close closes the connection pool
+func (pg *PGStore) Close() {
+	if pg.pool != nil {
+		pg.pool.Close()
+	}
+}
+
+// NewPGPool connects a connection pool to DB_SOURCE.
+// Pool settings that are left at zero keep the pgxpool defaults.
+func NewPGPool(ctx context.Context, config util.Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(config.DBSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DBMaxConns > 0 {
+		poolConfig.MaxConns = config.DBMaxConns
+	}
+	if config.DBMinConns > 0 {
+		poolConfig.MinConns = config.DBMinConns
+	}
+	if config.DBMaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = config.DBMaxConnLifetime
+	}
+	if config.DBMaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = config.DBMaxConnIdleTime
+	}
+	if config.DBHealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = config.DBHealthCheckPeriod
+	}
+
+	return pgxpool.ConnectConfig(ctx, poolConfig)
+}
+
+// PoolStats is a snapshot of the connection pool.
+// AcquiredConns close to MaxConns, or a growing EmptyAcquireCount,
+// means requests are waiting for a connection.
+type PoolStats struct {
+	MaxConns             int32         `json:"max_conns"`
+	TotalConns           int32         `json:"total_conns"`
+	AcquiredConns        int32         `json:"acquired_conns"`
+	IdleConns            int32         `json:"idle_conns"`
+	ConstructingConns    int32         `json:"constructing_conns"`
+	AcquireCount         int64         `json:"acquire_count"`
+	EmptyAcquireCount    int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireDuration      time.Duration `json:"acquire_duration_ns"`
+}
+
+// PoolStatser is implemented by stores backed by a connection pool
+type PoolStatser interface {
+	PoolStats() PoolStats
+}
+
+// PoolStats ...
+func (pg *PGStore) PoolStats() PoolStats {
+	if pg.pool == nil {
+		return PoolStats{}
+	}
+
+	stat := pg.pool.Stat()
+	return PoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
 	}
 }
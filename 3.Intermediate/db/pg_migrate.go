@@ -0,0 +1,257 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var pgMigrationFiles embed.FS
+
+// pgMigrationLockID is the pg_advisory_lock key held while migrating, so
+// only one of several instances starting at the same time migrates
+const pgMigrationLockID int64 = 4_627_881_553_170_914
+
+// PGMigrator applies the migrations embedded from db/migrations. It keeps
+// the schema version in the same schema_migrations table as golang-migrate,
+// so databases migrated with the migrate CLI carry on where they are.
+type PGMigrator struct {
+	pool       *pgxpool.Pool
+	migrations []migration
+}
+
+// NewPGMigrator ...
+func NewPGMigrator(pool *pgxpool.Pool) (*PGMigrator, error) {
+	fsys, err := fs.Sub(pgMigrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PGMigrator{pool: pool, migrations: migrations}, nil
+}
+
+// Up applies every pending migration. It fails with ErrSchemaAhead when the
+// database has migrations this binary does not know about.
+func (m *PGMigrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := m.checkVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if mig.version <= version {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, mig.up, mig.version); err != nil {
+				return err
+			}
+			l.I("applied migration", mig.version, mig.name)
+		}
+		return nil
+	})
+}
+
+// Down rolls back the last steps migrations
+func (m *PGMigrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := m.checkVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mig := m.migrations[i]
+			if mig.version > version {
+				continue
+			}
+			if mig.down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mig.version, mig.name)
+			}
+
+			var previous uint
+			if i > 0 {
+				previous = m.migrations[i-1].version
+			}
+			if err := m.run(ctx, conn, mig, mig.down, previous); err != nil {
+				return err
+			}
+			l.I("rolled back migration", mig.version, mig.name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// Force sets the schema version and clears the dirty flag without running
+// anything. It is the way out after a migration failed halfway and the
+// database was fixed by hand. Version 0 means no migration is applied.
+func (m *PGMigrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && m.find(version) < 0 {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if err := setSchemaVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// MigrationStatus ...
+type MigrationStatus struct {
+	// Version is the last applied migration, 0 when there is none
+	Version uint
+	Dirty   bool
+	// Latest is the newest migration this binary knows about
+	Latest     uint
+	Migrations []MigrationInfo
+}
+
+// MigrationInfo ...
+type MigrationInfo struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// Status reports the schema version next to the embedded migrations
+func (m *PGMigrator) Status(ctx context.Context) (MigrationStatus, error) {
+	var status MigrationStatus
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) (err error) {
+		status.Version, status.Dirty, err = schemaVersion(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	for _, mig := range m.migrations {
+		status.Latest = mig.version
+		status.Migrations = append(status.Migrations, MigrationInfo{
+			Version: mig.version,
+			Name:    mig.name,
+			Applied: mig.version <= status.Version,
+		})
+	}
+	return status, nil
+}
+
+// withLock runs fn on one connection that holds the migration lock
+func (m *PGMigrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return pgError(ctx, err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "select pg_advisory_lock($1)", pgMigrationLockID); err != nil {
+		return pgError(ctx, err)
+	}
+	defer func() {
+		// ctx may be done by now, the lock has to go anyway
+		if _, err := conn.Exec(context.Background(), "select pg_advisory_unlock($1)", pgMigrationLockID); err != nil {
+			l.E("unable to release the migration lock", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, "create table if not exists schema_migrations (version bigint not null primary key, dirty boolean not null)")
+	if err != nil {
+		return pgError(ctx, err)
+	}
+
+	return fn(conn)
+}
+
+// checkVersion returns the schema version if migrations may run on top of it
+func (m *PGMigrator) checkVersion(ctx context.Context, conn *pgxpool.Conn) (uint, error) {
+	version, dirty, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d", ErrSchemaDirty, version)
+	}
+	if latest := m.migrations[len(m.migrations)-1].version; version > latest {
+		return 0, fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaAhead, version, latest)
+	}
+	if version != 0 && m.find(version) < 0 {
+		return 0, fmt.Errorf("database is at version %d, which this build does not know", version)
+	}
+	return version, nil
+}
+
+func (m *PGMigrator) find(version uint) int {
+	for i, mig := range m.migrations {
+		if mig.version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// run executes sql and moves the schema to version in a single
+// transaction, Postgres rolls back schema changes like any other
+func (m *PGMigrator) run(ctx context.Context, conn *pgxpool.Conn, mig migration, sql string, version uint) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return pgError(ctx, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", mig.version, mig.name, pgError(ctx, err))
+	}
+	if err := setSchemaVersion(ctx, tx, version); err != nil {
+		return err
+	}
+
+	return pgError(ctx, tx.Commit(ctx))
+}
+
+func schemaVersion(ctx context.Context, conn *pgxpool.Conn) (version uint, dirty bool, err error) {
+	var v int64
+	err = conn.QueryRow(ctx, "select version, dirty from schema_migrations limit 1").Scan(&v, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, pgError(ctx, err)
+	}
+	// golang-migrate writes -1 when everything was rolled back
+	if v < 0 {
+		return 0, dirty, nil
+	}
+	return uint(v), dirty, nil
+}
+
+func setSchemaVersion(ctx context.Context, tx pgx.Tx, version uint) error {
+	if _, err := tx.Exec(ctx, "delete from schema_migrations"); err != nil {
+		return pgError(ctx, err)
+	}
+	if version == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, "insert into schema_migrations (version, dirty) values ($1, false)", int64(version))
+	return pgError(ctx, err)
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokeToken ..
+func (pg *PGStore) RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	_, err := pg.db.Exec(ctx, `
+	insert into revoked_tokens (id, expires_at, revoked_at) values ($1,$2,$3)
+	on conflict (id) do nothing
+	`, id, expiresAt, time.Now())
+	return pgError(ctx, err)
+}
+
+// RevokeUserTokens ..
+func (pg *PGStore) RevokeUserTokens(ctx context.Context, userName string, before time.Time, expiresAt time.Time) error {
+	_, err := pg.db.Exec(ctx, `
+	insert into revoked_user_tokens (user_name, revoked_before, expires_at) values ($1,$2,$3)
+	on conflict (user_name) do update set
+		revoked_before = greatest(revoked_user_tokens.revoked_before, excluded.revoked_before),
+		expires_at = greatest(revoked_user_tokens.expires_at, excluded.expires_at)
+	`, userName, before, expiresAt)
+	return pgError(ctx, err)
+}
+
+// IsTokenRevoked ..
+func (pg *PGStore) IsTokenRevoked(ctx context.Context, id uuid.UUID, userName string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := pg.db.QueryRow(ctx, `
+	select exists(select 1 from revoked_tokens where id=$1)
+		or exists(select 1 from revoked_user_tokens where user_name=$2 and revoked_before > $3)
+	`, id, userName, issuedAt).Scan(&revoked)
+	if err != nil {
+		return false, pgError(ctx, err)
+	}
+
+	return revoked, nil
+}
+
+// PruneRevokedTokens ..
+func (pg *PGStore) PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	// Both deletes are idempotent, a failure halfway is fixed by the next run
+	var n int64
+	for _, table := range []string{"revoked_tokens", "revoked_user_tokens"} {
+		tag, err := pg.db.Exec(ctx, "delete from "+table+" where expires_at < $1", before)
+		if err != nil {
+			return n, pgError(ctx, err)
+		}
+		n += tag.RowsAffected()
+	}
+
+	return n, nil
+}
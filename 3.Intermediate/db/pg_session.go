@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSessionReused is returned when a refresh token is presented a second time
+var ErrSessionReused = errors.New("session has already been used")
+
+// SessionRequest ...
+type SessionRequest struct {
+	ID        uuid.UUID
+	FamilyID  uuid.UUID
+	UserName  string
+	TokenHash string
+	UserAgent string
+	ClientIP  string
+	ExpiresAt time.Time
+}
+
+// Session is a server side record of a refresh token.
+// Every rotation creates a new session in the same family.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	FamilyID   uuid.UUID  `json:"family_id"`
+	UserName   string     `json:"user_name"`
+	TokenHash  string     `json:"-" secret:"true"`
+	UserAgent  string     `json:"user_agent"`
+	ClientIP   string     `json:"client_ip"`
+	IsBlocked  bool       `json:"is_blocked"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateSession ..
+func (pg *PGStore) CreateSession(ctx context.Context, session SessionRequest) (Session, error) {
+	var s Session
+	err := pg.db.QueryRow(ctx, `
+	insert into sessions (id, family_id, user_name, token_hash, user_agent, client_ip, expires_at, created_at) values
+		($1,$2,$3,$4,$5,$6,$7,$8)
+	RETURNING id, family_id, user_name, token_hash, user_agent, client_ip, is_blocked, replaced_by, expires_at, created_at;
+	`, session.ID, session.FamilyID, session.UserName, session.TokenHash, session.UserAgent, session.ClientIP, session.ExpiresAt, time.Now()).Scan(&s.ID, &s.FamilyID, &s.UserName, &s.TokenHash, &s.UserAgent, &s.ClientIP, &s.IsBlocked, &s.ReplacedBy, &s.ExpiresAt, &s.CreatedAt)
+	if err != nil {
+		return Session{}, pgError(ctx, err)
+	}
+
+	return s, nil
+}
+
+// GetSessionByTokenHash ..
+func (pg *PGStore) GetSessionByTokenHash(ctx context.Context, tokenHash string) (Session, error) {
+	var s Session
+	err := pg.db.QueryRow(ctx, `
+	select id, family_id, user_name, token_hash, user_agent, client_ip, is_blocked, replaced_by, expires_at, created_at
+	from sessions where token_hash=$1
+	`, tokenHash).Scan(&s.ID, &s.FamilyID, &s.UserName, &s.TokenHash, &s.UserAgent, &s.ClientIP, &s.IsBlocked, &s.ReplacedBy, &s.ExpiresAt, &s.CreatedAt)
+	if err != nil {
+		return Session{}, pgError(ctx, err)
+	}
+
+	return s, nil
+}
+
+// ReplaceSession ..
+func (pg *PGStore) ReplaceSession(ctx context.Context, id uuid.UUID, replacedBy uuid.UUID) error {
+	// The replaced_by check makes this a compare-and-swap, so only one of two
+	// concurrent renewals with the same refresh token can win
+	tag, err := pg.db.Exec(ctx, `
+	update sessions set replaced_by=$2
+	where id=$1 and replaced_by is null and not is_blocked
+	`, id, replacedBy)
+	if err != nil {
+		return pgError(ctx, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionReused
+	}
+
+	return nil
+}
+
+// BlockSessionFamily ..
+func (pg *PGStore) BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := pg.db.Exec(ctx, "update sessions set is_blocked=true where family_id=$1", familyID)
+	return pgError(ctx, err)
+}
+
+// BlockUserSessions ..
+func (pg *PGStore) BlockUserSessions(ctx context.Context, userName string) error {
+	_, err := pg.db.Exec(ctx, "update sessions set is_blocked=true where user_name=$1", userName)
+	return pgError(ctx, err)
+}
@@ -0,0 +1,48 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db/storetest"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+// TEST_DB_SOURCE must point at a database whose tables may be emptied,
+// never at one with data you want to keep. It is migrated first.
+func TestPGStore(t *testing.T) {
+	source := os.Getenv("TEST_DB_SOURCE")
+	if source == "" {
+		t.Skip("TEST_DB_SOURCE is not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) db.Store {
+		ctx := context.Background()
+
+		pool, err := db.NewPGPool(ctx, util.Config{DBSource: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrator, err := db.NewPGMigrator(pool)
+		if err == nil {
+			err = migrator.Up(ctx)
+		}
+		if err != nil {
+			pool.Close()
+			t.Fatal(err)
+		}
+
+		_, err = pool.Exec(ctx, "truncate users, sessions, revoked_tokens, revoked_user_tokens cascade")
+		if err != nil {
+			pool.Close()
+			t.Fatal(err)
+		}
+
+		store := db.NewPGStore(pool)
+		t.Cleanup(store.Close)
+		return store
+	})
+}
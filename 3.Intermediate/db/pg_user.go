@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
@@ -10,30 +11,73 @@ import (
 type UserRequest struct {
 	UserName  string    `json:"user_name" binding:"required,alphanum"`
 	Email     string    `json:"email" binding:"required,email"`
-	Password  string    `json:"password" binding:"required,min=6"`
+	Password  string    `json:"password" binding:"required,min=6" secret:"true"`
 	FullName  string    `json:"full_name"`
 	FirstName string    `json:"first_name" binding:"required"`
 	LastName  string    `json:"last_name" binding:"required"`
 	CreatedAt time.Time `json:"created_at"`
+	// HashedPassword is stored instead of a hash of Password when set, so
+	// callers can run bcrypt before a transaction instead of inside of it
+	HashedPassword string `json:"-"`
 }
 
-// UserResponse ...
+// passHash returns the hash to store for the user
+func (u UserRequest) passHash() (string, error) {
+	if u.HashedPassword != "" {
+		return u.HashedPassword, nil
+	}
+	return util.HashPassword(u.Password)
+}
+
+// UserPatch holds the fields UpdateUser changes, nil fields are left alone
+type UserPatch struct {
+	FirstName *string `json:"first_name" binding:"omitempty,min=1,max=40"`
+	LastName  *string `json:"last_name" binding:"omitempty,min=1,max=40"`
+	Email     *string `json:"email" binding:"omitempty,email"`
+	// Password is stored as a new hash
+	Password *string `json:"password" binding:"omitempty,min=6" secret:"true"`
+	// HashedPassword is stored instead of a hash of Password when set, like
+	// in UserRequest
+	HashedPassword *string `json:"-"`
+}
+
+// hashPassword returns the hash of the new password, or nil when the
+// password does not change
+func (p UserPatch) hashPassword() (*string, error) {
+	if p.HashedPassword != nil {
+		return p.HashedPassword, nil
+	}
+	if p.Password == nil {
+		return nil, nil
+	}
+
+	passHash, err := util.HashPassword(*p.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &passHash, nil
+}
+
+// UserResponse is a user as stored. Fields tagged secret must never be sent
+// to clients, the api package has its own representation for that.
 type UserResponse struct {
 	UserName       string    `json:"user_name"`
 	Email          string    `json:"email"`
 	FullName       string    `json:"full_name"`
 	FirstName      string    `json:"first_name"`
 	LastName       string    `json:"last_name"`
-	HashedPassword string    `json:"pass_hash"`
+	HashedPassword string    `json:"-" secret:"true"`
+	Roles          []string  `json:"roles"`
+	Scopes         []string  `json:"scopes"`
 	CreatedAt      time.Time `json:"created_at,omitempty"`
 }
 
 // GetUserByUsername ..
 func (pg *PGStore) GetUserByUserName(ctx context.Context, userName string) (UserResponse, error) {
 	var ur UserResponse
-	err := pg.db.QueryRow(context.Background(), "select user_name, first_name, last_name, created_at, pass_hash from users where user_name=$1", userName).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.CreatedAt, &ur.HashedPassword)
+	err := pg.db.QueryRow(ctx, "select user_name, first_name, last_name, email, created_at, pass_hash, roles, scopes from users where user_name=$1", userName).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.HashedPassword, &ur.Roles, &ur.Scopes)
 	if err != nil {
-		return UserResponse{}, err
+		return UserResponse{}, pgError(ctx, err)
 	}
 
 	return ur, nil
@@ -42,71 +86,103 @@ func (pg *PGStore) GetUserByUserName(ctx context.Context, userName string) (User
 // GetUserByEmail ..
 func (pg *PGStore) GetUserByEmail(ctx context.Context, email string) (UserResponse, error) {
 	var ur UserResponse
-	err := pg.db.QueryRow(context.Background(), "select user_name, first_name, last_name, created_at from users where email=$1", email).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.CreatedAt)
+	err := pg.db.QueryRow(ctx, "select user_name, first_name, last_name, email, created_at, roles, scopes from users where email=$1", email).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.Roles, &ur.Scopes)
 	if err != nil {
-		return UserResponse{}, err
+		return UserResponse{}, pgError(ctx, err)
 	}
 
 	return ur, nil
 }
 
-// CreateUser ..
+// CreateUser inserts a new user. It returns ErrDuplicateUserName or
+// ErrDuplicateEmail when either is taken, existing users are never changed.
 func (pg *PGStore) CreateUser(ctx context.Context, user UserRequest) (UserResponse, error) {
 	var ur UserResponse
 
-	passHash, err := util.HashPassword(user.Password)
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
 
+	err = pg.db.QueryRow(ctx, `
+	insert into users (user_name, first_name, last_name, email, pass_hash, created_at) values 
+		($1,$2,$3,$4,$5,$6)
+	RETURNING user_name, first_name, last_name, email, created_at, roles, scopes;
+	`, user.UserName, user.FirstName, user.LastName, user.Email, passHash, time.Now()).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.Roles, &ur.Scopes)
+	if err != nil {
+		return UserResponse{}, pgError(ctx, err)
+	}
+
+	return ur, nil
+}
+
+// UpsertUser creates the user, or replaces name, email and password of an
+// existing user with the same user name. It is meant for bulk provisioning.
+func (pg *PGStore) UpsertUser(ctx context.Context, user UserRequest) (UserResponse, error) {
+	var ur UserResponse
+
+	passHash, err := user.passHash()
 	if err != nil {
 		return UserResponse{}, err
 	}
 
-	err = pg.db.QueryRow(context.Background(), `
+	err = pg.db.QueryRow(ctx, `
 	insert into users (user_name, first_name, last_name, email, pass_hash, created_at) values 
 		($1,$2,$3,$4,$5,$6)
 	on conflict (user_name) do 
 		update set 
-			user_name = excluded.user_name,
 			first_name = excluded.first_name,
 			last_name = excluded.last_name,
 			email = excluded.email,
 			pass_hash = excluded.pass_hash
-	RETURNING user_name;
-	`, user.UserName, user.FirstName, user.LastName, user.Email, passHash, time.Now()).Scan(&ur.UserName)
+	RETURNING user_name, first_name, last_name, email, created_at, roles, scopes;
+	`, user.UserName, user.FirstName, user.LastName, user.Email, passHash, time.Now()).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.Roles, &ur.Scopes)
 	if err != nil {
-		return UserResponse{}, err
+		return UserResponse{}, pgError(ctx, err)
 	}
 
 	return ur, nil
 }
 
-// UpdateUser ..
-func (pg *PGStore) UpdateUser(ctx context.Context, user UserRequest) (UserResponse, error) {
-	var ur UserResponse
-	err := pg.db.QueryRow(context.Background(), `
-	insert into users (user_name, first_name, last_name, email, pass_hash, created_at) values 
-		($1,$2,$3,$4,$5,$6)
-	on conflict (user_name) do 
-		update set 
-			user_name = coalesce(users.user_name, excluded.user_name),
-			first_name = coalesce(users.first_name, excluded.first_name),
-			last_name = coalesce(users.last_name, excluded.last_name),
-			email = coalesce(users.email, excluded.email),
-			created_at = coalesce(users.created_at, excluded.created_at),
-			pass_hash = users.pass_hash
-	RETURNING user_name;
-	`, user.UserName, user.FirstName, user.LastName, user.Email, "pass_hash", time.Now()).Scan(&ur.UserName)
+// UpdateUser changes the fields set in patch and returns the updated user.
+// It returns ErrNotFound when there is no such user.
+func (pg *PGStore) UpdateUser(ctx context.Context, userName string, patch UserPatch) (UserResponse, error) {
+	passHash, err := patch.hashPassword()
 	if err != nil {
 		return UserResponse{}, err
 	}
 
+	var ur UserResponse
+	err = pg.db.QueryRow(ctx, `
+	update users set
+		first_name = coalesce($2, first_name),
+		last_name = coalesce($3, last_name),
+		email = coalesce($4, email),
+		pass_hash = coalesce($5, pass_hash)
+	where user_name = $1
+	RETURNING user_name, first_name, last_name, email, created_at, roles, scopes;
+	`, userName, patch.FirstName, patch.LastName, patch.Email, passHash).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.Roles, &ur.Scopes)
+	if err != nil {
+		return UserResponse{}, pgError(ctx, err)
+	}
+
 	return ur, nil
 }
 
-// GetUsers ...
-func (pg *PGStore) GetUsers(ctx context.Context) ([]UserResponse, error) {
-	rows, err := pg.db.Query(context.Background(), "select user_name, first_name, last_name, email from users")
+// GetUsers returns one page of users, see ListUsersOptions
+func (pg *PGStore) GetUsers(ctx context.Context, opts ListUsersOptions) (UserPage, error) {
+	q, err := newUserListQuery(opts)
 	if err != nil {
-		return nil, err
+		return UserPage{}, err
+	}
+
+	sql, args := q.sql(
+		func(n int) string { return fmt.Sprintf("$%d", n) },
+		func(column string, prefix string) string { return fmt.Sprintf("starts_with(%s, %s)", column, prefix) },
+	)
+	rows, err := pg.db.Query(ctx, sql, args...)
+	if err != nil {
+		return UserPage{}, pgError(ctx, err)
 	}
 
 	defer rows.Close()
@@ -114,8 +190,14 @@ func (pg *PGStore) GetUsers(ctx context.Context) ([]UserResponse, error) {
 	var users = make([]UserResponse, 0)
 	for rows.Next() {
 		var ur UserResponse
-		rows.Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email)
+		err = rows.Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.Roles, &ur.Scopes)
+		if err != nil {
+			return UserPage{}, pgError(ctx, err)
+		}
 		users = append(users, ur)
 	}
-	return users, nil
+	if err = rows.Err(); err != nil {
+		return UserPage{}, pgError(ctx, err)
+	}
+	return q.page(users), nil
 }
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+)
+
+// RunRevocationPruner removes expired revocations every interval until ctx is done
+func RunRevocationPruner(ctx context.Context, revoker TokenRevoker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := revoker.PruneRevokedTokens(ctx, now)
+			if err != nil {
+				l.E("failed to prune revoked tokens", err)
+				continue
+			}
+			l.D("pruned revoked tokens", n)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+	"github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationFiles embed.FS
+
+// sqliteParams are added to every DB_SOURCE. Foreign keys are off by
+// default in SQLite, and _txlock=immediate takes the write lock when a
+// transaction begins, so two writers wait for each other through the busy
+// timeout instead of failing halfway.
+const sqliteParams = "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+
+// sqlDBTX is what the queries need, both *sql.DB and *sql.Tx provide it
+type sqlDBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SQLiteStore is a Store in a single SQLite file, for tools that want the
+// user and login API without running Postgres.
+//
+// SQLite transactions are always serializable, so TxOptions.IsoLevel is
+// ignored. MaxRetries still applies when the database stays locked.
+type SQLiteStore struct {
+	db sqlDBTX
+	// conn is nil for a SQLiteStore bound to a transaction
+	conn *sql.DB
+}
+
+// NewSQLiteStore opens the SQLite database in DB_SOURCE, for example
+// "file:myapp.db", creates it when it is missing and migrates it
+func NewSQLiteStore(ctx context.Context, config util.Config) (Store, error) {
+	conn, err := sql.Open("sqlite3", sqliteDSN(config.DBSource))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to ":memory:" would get a database of its own
+	if strings.Contains(config.DBSource, ":memory:") || strings.Contains(config.DBSource, "mode=memory") {
+		conn.SetMaxOpenConns(1)
+		conn.SetConnMaxLifetime(0)
+	} else if config.DBMaxConns > 0 {
+		conn.SetMaxOpenConns(int(config.DBMaxConns))
+	}
+	if config.DBMaxConnLifetime > 0 {
+		conn.SetConnMaxLifetime(config.DBMaxConnLifetime)
+	}
+	if config.DBMaxConnIdleTime > 0 {
+		conn.SetConnMaxIdleTime(config.DBMaxConnIdleTime)
+	}
+
+	if err := migrateSQLite(ctx, conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to migrate sqlite database: %w", err)
+	}
+
+	return &SQLiteStore{db: conn, conn: conn}, nil
+}
+
+func sqliteDSN(source string) string {
+	if strings.Contains(source, "?") {
+		return source + "&" + sqliteParams
+	}
+	return source + "?" + sqliteParams
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// PoolStats maps the database/sql statistics onto PoolStats
+func (s *SQLiteStore) PoolStats() PoolStats {
+	if s.conn == nil {
+		return PoolStats{}
+	}
+
+	stat := s.conn.Stats()
+	return PoolStats{
+		MaxConns:          int32(stat.MaxOpenConnections),
+		TotalConns:        int32(stat.OpenConnections),
+		AcquiredConns:     int32(stat.InUse),
+		IdleConns:         int32(stat.Idle),
+		EmptyAcquireCount: stat.WaitCount,
+		AcquireDuration:   stat.WaitDuration,
+	}
+}
+
+// migrateSQLite brings the database up to the newest embedded migration.
+// Versions are kept in a schema_migrations table like golang-migrate does,
+// so the migrate CLI can take over the same file. Every step runs in a
+// transaction of its own, SQLite can roll back schema changes too.
+func migrateSQLite(ctx context.Context, conn *sql.DB) error {
+	fsys, err := fs.Sub(sqliteMigrationFiles, "migrations/sqlite")
+	if err != nil {
+		return err
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `
+	create table if not exists schema_migrations (version uint64, dirty bool);
+	create unique index if not exists version_unique on schema_migrations (version);
+	`)
+	if err != nil {
+		return err
+	}
+
+	var version uint
+	err = conn.QueryRowContext(ctx, "select version from schema_migrations limit 1").Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; version > latest {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaAhead, version, latest)
+	}
+
+	for _, m := range migrations {
+		applied, err := applySQLiteMigration(ctx, conn, m)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.version, m.name, err)
+		}
+		if applied {
+			l.I("applied sqlite migration", m.version, m.name)
+		}
+	}
+
+	return nil
+}
+
+// applySQLiteMigration runs m unless the schema is already at or past it.
+// The version is read inside the transaction, so two processes opening the
+// same file never apply a migration twice.
+func applySQLiteMigration(ctx context.Context, conn *sql.DB, m migration) (applied bool, err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var version uint
+	var dirty bool
+	err = tx.QueryRowContext(ctx, "select version, dirty from schema_migrations limit 1").Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if dirty {
+		return false, fmt.Errorf("%w at version %d, fix it by hand", ErrSchemaDirty, version)
+	}
+	if version >= m.version {
+		return false, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, m.up); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, "delete from schema_migrations"); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, "insert into schema_migrations (version, dirty) values (?, false)", m.version); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// ExecTx ..
+func (s *SQLiteStore) ExecTx(ctx context.Context, fn func(q Queries) error) error {
+	return s.ExecTxOptions(ctx, DefaultTxOptions, fn)
+}
+
+// ExecTxOptions ..
+func (s *SQLiteStore) ExecTxOptions(ctx context.Context, opts TxOptions, fn func(q Queries) error) error {
+	if s.conn == nil {
+		return errors.New("nested transactions are not supported")
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := s.execTx(ctx, fn)
+		if err == nil || attempt >= opts.MaxRetries || !isSQLiteBusy(err) {
+			return err
+		}
+
+		l.D("retrying transaction", attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return sqliteError(ctx, ctx.Err())
+		case <-time.After(txRetryBackoff * time.Duration(attempt+1)):
+		}
+	}
+}
+
+func (s *SQLiteStore) execTx(ctx context.Context, fn func(q Queries) error) (err error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return sqliteError(ctx, err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(&SQLiteStore{db: tx})
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %w, rollback err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return sqliteError(ctx, tx.Commit())
+}
+
+func isSQLiteBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// sqliteError translates errors coming out of SQLite into the errors of
+// this package, the same ones pgError returns for Postgres
+func sqliteError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := contextError(ctx, err); ctxErr != nil {
+		return ctxErr
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return err
+	}
+
+	// SQLite names the columns rather than the constraint,
+	// as in "UNIQUE constraint failed: users.email"
+	var columns, table string
+	if i := strings.LastIndex(sqliteErr.Error(), ": "); i >= 0 {
+		columns = sqliteErr.Error()[i+2:]
+		table = strings.SplitN(columns, ".", 2)[0]
+	}
+
+	code := pgIntegrityConstraintClass + "000"
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintPrimaryKey, sqlite3.ErrConstraintUnique:
+		switch columns {
+		case "users.user_name":
+			return ErrDuplicateUserName
+		case "users.email":
+			return ErrDuplicateEmail
+		}
+		code = pgUniqueViolation
+	case sqlite3.ErrConstraintForeignKey:
+		code = pgForeignKeyViolation
+	}
+
+	return &ConstraintError{
+		Code:       code,
+		Table:      table,
+		Constraint: columns,
+		Message:    sqliteErr.Error(),
+	}
+}
+
+// sqliteStrings scans a JSON array of strings, SQLite has no array type
+type sqliteStrings []string
+
+func (s *sqliteStrings) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into a list of strings", src)
+	}
+
+	*s = sqliteStrings{}
+	return json.Unmarshal(data, (*[]string)(s))
+}
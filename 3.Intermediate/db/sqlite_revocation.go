@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokeToken ..
+func (s *SQLiteStore) RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+	insert into revoked_tokens (id, expires_at, revoked_at) values (?,?,?)
+	on conflict (id) do nothing
+	`, id, expiresAt.UTC(), time.Now().UTC())
+	return sqliteError(ctx, err)
+}
+
+// RevokeUserTokens ..
+func (s *SQLiteStore) RevokeUserTokens(ctx context.Context, userName string, before time.Time, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+	insert into revoked_user_tokens (user_name, revoked_before, expires_at) values (?,?,?)
+	on conflict (user_name) do update set
+		revoked_before = max(revoked_before, excluded.revoked_before),
+		expires_at = max(expires_at, excluded.expires_at)
+	`, userName, before.UTC(), expiresAt.UTC())
+	return sqliteError(ctx, err)
+}
+
+// IsTokenRevoked ..
+func (s *SQLiteStore) IsTokenRevoked(ctx context.Context, id uuid.UUID, userName string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, `
+	select exists(select 1 from revoked_tokens where id=?)
+		or exists(select 1 from revoked_user_tokens where user_name=? and revoked_before > ?)
+	`, id, userName, issuedAt.UTC()).Scan(&revoked)
+	if err != nil {
+		return false, sqliteError(ctx, err)
+	}
+
+	return revoked, nil
+}
+
+// PruneRevokedTokens ..
+func (s *SQLiteStore) PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	// Timestamps are stored as UTC text, which sorts like the times it holds
+	var n int64
+	for _, table := range []string{"revoked_tokens", "revoked_user_tokens"} {
+		res, err := s.db.ExecContext(ctx, "delete from "+table+" where expires_at < ?", before.UTC())
+		if err != nil {
+			return n, sqliteError(ctx, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += affected
+	}
+
+	return n, nil
+}
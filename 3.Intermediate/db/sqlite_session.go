@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateSession ..
+func (s *SQLiteStore) CreateSession(ctx context.Context, session SessionRequest) (Session, error) {
+	// No "returning" here, SQLite does not tell the driver that the
+	// returned timestamps are timestamps
+	ss := Session{
+		ID:        session.ID,
+		FamilyID:  session.FamilyID,
+		UserName:  session.UserName,
+		TokenHash: session.TokenHash,
+		UserAgent: session.UserAgent,
+		ClientIP:  session.ClientIP,
+		ExpiresAt: session.ExpiresAt.UTC(),
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := s.db.ExecContext(ctx, `
+	insert into sessions (id, family_id, user_name, token_hash, user_agent, client_ip, expires_at, created_at) values
+		(?,?,?,?,?,?,?,?)
+	`, ss.ID, ss.FamilyID, ss.UserName, ss.TokenHash, ss.UserAgent, ss.ClientIP, ss.ExpiresAt, ss.CreatedAt)
+	if err != nil {
+		return Session{}, sqliteError(ctx, err)
+	}
+
+	return ss, nil
+}
+
+// GetSessionByTokenHash ..
+func (s *SQLiteStore) GetSessionByTokenHash(ctx context.Context, tokenHash string) (Session, error) {
+	var ss Session
+	err := s.db.QueryRowContext(ctx, `
+	select id, family_id, user_name, token_hash, user_agent, client_ip, is_blocked, replaced_by, expires_at, created_at
+	from sessions where token_hash=?
+	`, tokenHash).Scan(&ss.ID, &ss.FamilyID, &ss.UserName, &ss.TokenHash, &ss.UserAgent, &ss.ClientIP, &ss.IsBlocked, &ss.ReplacedBy, &ss.ExpiresAt, &ss.CreatedAt)
+	if err != nil {
+		return Session{}, sqliteError(ctx, err)
+	}
+
+	return ss, nil
+}
+
+// ReplaceSession ..
+func (s *SQLiteStore) ReplaceSession(ctx context.Context, id uuid.UUID, replacedBy uuid.UUID) error {
+	// Same compare-and-swap as PGStore.ReplaceSession
+	res, err := s.db.ExecContext(ctx, `
+	update sessions set replaced_by=?
+	where id=? and replaced_by is null and not is_blocked
+	`, replacedBy, id)
+	if err != nil {
+		return sqliteError(ctx, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return sqliteError(ctx, err)
+	}
+	if n == 0 {
+		return ErrSessionReused
+	}
+
+	return nil
+}
+
+// BlockSessionFamily ..
+func (s *SQLiteStore) BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, "update sessions set is_blocked=true where family_id=?", familyID)
+	return sqliteError(ctx, err)
+}
+
+// BlockUserSessions ..
+func (s *SQLiteStore) BlockUserSessions(ctx context.Context, userName string) error {
+	_, err := s.db.ExecContext(ctx, "update sessions set is_blocked=true where user_name=?", userName)
+	return sqliteError(ctx, err)
+}
@@ -0,0 +1,24 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db/storetest"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) db.Store {
+		source := "file:" + filepath.Join(t.TempDir(), "test.db")
+
+		store, err := db.NewSQLiteStore(context.Background(), util.Config{DBSource: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(store.Close)
+		return store
+	})
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GetUserByUserName ..
+func (s *SQLiteStore) GetUserByUserName(ctx context.Context, userName string) (UserResponse, error) {
+	var ur UserResponse
+	err := s.db.QueryRowContext(ctx, "select user_name, first_name, last_name, email, created_at, pass_hash, roles, scopes from users where user_name=?", userName).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, &ur.HashedPassword, (*sqliteStrings)(&ur.Roles), (*sqliteStrings)(&ur.Scopes))
+	if err != nil {
+		return UserResponse{}, sqliteError(ctx, err)
+	}
+
+	return ur, nil
+}
+
+// GetUserByEmail ..
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (UserResponse, error) {
+	var ur UserResponse
+	err := s.db.QueryRowContext(ctx, "select user_name, first_name, last_name, email, created_at, roles, scopes from users where email=?", email).Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, (*sqliteStrings)(&ur.Roles), (*sqliteStrings)(&ur.Scopes))
+	if err != nil {
+		return UserResponse{}, sqliteError(ctx, err)
+	}
+
+	return ur, nil
+}
+
+// CreateUser inserts a new user. It returns ErrDuplicateUserName or
+// ErrDuplicateEmail when either is taken, existing users are never changed.
+func (s *SQLiteStore) CreateUser(ctx context.Context, user UserRequest) (UserResponse, error) {
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+	insert into users (user_name, first_name, last_name, email, pass_hash, created_at) values
+		(?,?,?,?,?,?)
+	`, user.UserName, user.FirstName, user.LastName, user.Email, passHash, time.Now().UTC())
+	if err != nil {
+		return UserResponse{}, sqliteError(ctx, err)
+	}
+
+	return s.readUser(ctx, user.UserName)
+}
+
+// UpsertUser creates the user, or replaces name, email and password of an
+// existing user with the same user name. It is meant for bulk provisioning.
+func (s *SQLiteStore) UpsertUser(ctx context.Context, user UserRequest) (UserResponse, error) {
+	passHash, err := user.passHash()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+	insert into users (user_name, first_name, last_name, email, pass_hash, created_at) values
+		(?,?,?,?,?,?)
+	on conflict (user_name) do
+		update set
+			first_name = excluded.first_name,
+			last_name = excluded.last_name,
+			email = excluded.email,
+			pass_hash = excluded.pass_hash
+	`, user.UserName, user.FirstName, user.LastName, user.Email, passHash, time.Now().UTC())
+	if err != nil {
+		return UserResponse{}, sqliteError(ctx, err)
+	}
+
+	return s.readUser(ctx, user.UserName)
+}
+
+// readUser reads a user back after a write, rather than using "returning",
+// which loses the column types. The hash stays out of the result.
+func (s *SQLiteStore) readUser(ctx context.Context, userName string) (UserResponse, error) {
+	ur, err := s.GetUserByUserName(ctx, userName)
+	ur.HashedPassword = ""
+	return ur, err
+}
+
+// UpdateUser changes the fields set in patch and returns the updated user.
+// It returns ErrNotFound when there is no such user.
+func (s *SQLiteStore) UpdateUser(ctx context.Context, userName string, patch UserPatch) (UserResponse, error) {
+	passHash, err := patch.hashPassword()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+	update users set
+		first_name = coalesce(?2, first_name),
+		last_name = coalesce(?3, last_name),
+		email = coalesce(?4, email),
+		pass_hash = coalesce(?5, pass_hash)
+	where user_name = ?1;
+	`, userName, patch.FirstName, patch.LastName, patch.Email, passHash)
+	if err != nil {
+		return UserResponse{}, sqliteError(ctx, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return UserResponse{}, sqliteError(ctx, err)
+	}
+	if n == 0 {
+		return UserResponse{}, ErrNotFound
+	}
+
+	return s.readUser(ctx, userName)
+}
+
+// GetUsers returns one page of users, see ListUsersOptions
+func (s *SQLiteStore) GetUsers(ctx context.Context, opts ListUsersOptions) (UserPage, error) {
+	q, err := newUserListQuery(opts)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	// LIKE ignores case in SQLite, substr does not
+	sql, args := q.sql(
+		func(n int) string { return fmt.Sprintf("?%d", n) },
+		func(column string, prefix string) string {
+			return fmt.Sprintf("substr(%s, 1, length(%s)) = %s", column, prefix, prefix)
+		},
+	)
+	rows, err := s.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return UserPage{}, sqliteError(ctx, err)
+	}
+
+	defer rows.Close()
+
+	var users = make([]UserResponse, 0)
+	for rows.Next() {
+		var ur UserResponse
+		err = rows.Scan(&ur.UserName, &ur.FirstName, &ur.LastName, &ur.Email, &ur.CreatedAt, (*sqliteStrings)(&ur.Roles), (*sqliteStrings)(&ur.Scopes))
+		if err != nil {
+			return UserPage{}, sqliteError(ctx, err)
+		}
+		users = append(users, ur)
+	}
+	if err = rows.Err(); err != nil {
+		return UserPage{}, sqliteError(ctx, err)
+	}
+	return q.page(users), nil
+}
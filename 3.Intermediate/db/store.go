@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+// Supported DB_DRIVER values
+const (
+	DriverPostgres = "postgres"
+	// DriverMemory keeps everything in process memory and needs no database
+	DriverMemory = "memory"
+	// DriverSQLite keeps everything in the SQLite file named by DB_SOURCE
+	DriverSQLite = "sqlite"
+)
+
+// NewStore opens the Store selected by DB_DRIVER and brings its schema up
+// to date. An empty driver means Postgres.
+func NewStore(ctx context.Context, config util.Config) (Store, error) {
+	switch config.DBDriver {
+	case "", DriverPostgres:
+		pool, err := NewPGPool(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to database: %w", err)
+		}
+
+		migrator, err := NewPGMigrator(pool)
+		if err == nil {
+			err = migrator.Up(ctx)
+		}
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("unable to migrate database: %w", err)
+		}
+		return NewPGStore(pool), nil
+	case DriverMemory:
+		return NewMemStore(), nil
+	case DriverSQLite:
+		return NewSQLiteStore(ctx, config)
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q", config.DBDriver)
+	}
+}
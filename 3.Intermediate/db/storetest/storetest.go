@@ -0,0 +1,775 @@
+// Package storetest is a conformance suite for db.Store implementations.
+// Every backend should pass it, so handlers can rely on the same behaviour
+// and the same errors whichever store they are given.
+//
+//	func TestMemStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) db.Store {
+//			return db.NewMemStore()
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+// Factory returns an empty store. It is called once for every sub test and
+// is responsible for cleaning up after it, for example with t.Cleanup.
+type Factory func(t *testing.T) db.Store
+
+// Run runs the whole suite against stores made by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store db.Store)
+	}{
+		{"CreateUser", testCreateUser},
+		{"GetUserByEmail", testGetUserByEmail},
+		{"GetUserNotFound", testGetUserNotFound},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"DuplicateUserName", testDuplicateUserName},
+		{"UpsertUser", testUpsertUser},
+		{"UpdateUser", testUpdateUser},
+		{"UpdateUserNotFound", testUpdateUserNotFound},
+		{"UpdateUserDuplicateEmail", testUpdateUserDuplicateEmail},
+		{"GetUsers", testGetUsers},
+		{"GetUsersPages", testGetUsersPages},
+		{"GetUsersFilters", testGetUsersFilters},
+		{"GetUsersInvalidOptions", testGetUsersInvalidOptions},
+		{"Sessions", testSessions},
+		{"SessionReuse", testSessionReuse},
+		{"RevokeToken", testRevokeToken},
+		{"RevokeUserTokens", testRevokeUserTokens},
+		{"BlockUserSessions", testBlockUserSessions},
+		{"ExecTxCommit", testExecTxCommit},
+		{"ExecTxRollback", testExecTxRollback},
+		{"ContextCanceled", testContextCanceled},
+		{"ContextDeadline", testContextDeadline},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+func newUser(name string) db.UserRequest {
+	return db.UserRequest{
+		UserName:  name,
+		Email:     name + "@example.com",
+		Password:  "secret-" + name,
+		FirstName: "First " + name,
+		LastName:  "Last " + name,
+	}
+}
+
+func mustCreateUser(t *testing.T, store db.Store, req db.UserRequest) {
+	t.Helper()
+
+	_, err := store.CreateUser(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", req.UserName, err)
+	}
+}
+
+func checkUser(t *testing.T, got db.UserResponse, want db.UserRequest) {
+	t.Helper()
+
+	if got.UserName != want.UserName || got.Email != want.Email ||
+		got.FirstName != want.FirstName || got.LastName != want.LastName {
+		t.Errorf("got user %+v, want %+v", got, want)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Errorf("user %s has no created_at", got.UserName)
+	}
+}
+
+func testCreateUser(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	req := newUser("alice")
+
+	created, err := store.CreateUser(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, created, req)
+	if created.HashedPassword != "" {
+		t.Error("CreateUser must not return the password hash")
+	}
+
+	got, err := store.GetUserByUserName(ctx, req.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, got, req)
+
+	if err := util.CheckPassword(req.Password, got.HashedPassword); err != nil {
+		t.Errorf("stored hash does not match the password: %v", err)
+	}
+	if got.Roles == nil || got.Scopes == nil {
+		t.Errorf("roles and scopes should be empty, not nil: %+v", got)
+	}
+}
+
+func testGetUserByEmail(t *testing.T, store db.Store) {
+	req := newUser("bob")
+	mustCreateUser(t, store, req)
+
+	got, err := store.GetUserByEmail(context.Background(), req.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, got, req)
+}
+
+func testGetUserNotFound(t *testing.T, store db.Store) {
+	ctx := context.Background()
+
+	_, err := store.GetUserByUserName(ctx, "nobody")
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetUserByUserName: got %v, want %v", err, db.ErrNotFound)
+	}
+
+	_, err = store.GetUserByEmail(ctx, "nobody@example.com")
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("GetUserByEmail: got %v, want %v", err, db.ErrNotFound)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, store db.Store) {
+	mustCreateUser(t, store, newUser("carol"))
+
+	req := newUser("dave")
+	req.Email = newUser("carol").Email
+
+	_, err := store.CreateUser(context.Background(), req)
+	if !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("got %v, want %v", err, db.ErrDuplicateEmail)
+	}
+}
+
+func testDuplicateUserName(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	req := newUser("nina")
+	mustCreateUser(t, store, req)
+
+	takeover := newUser("nina")
+	takeover.Email = "attacker@example.com"
+	takeover.Password = "attacker"
+
+	_, err := store.CreateUser(ctx, takeover)
+	if !errors.Is(err, db.ErrDuplicateUserName) {
+		t.Errorf("got %v, want %v", err, db.ErrDuplicateUserName)
+	}
+
+	got, err := store.GetUserByUserName(ctx, req.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, got, req)
+	if err := util.CheckPassword(req.Password, got.HashedPassword); err != nil {
+		t.Errorf("password of the existing user changed: %v", err)
+	}
+}
+
+func testUpsertUser(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	req := newUser("quinn")
+
+	created, err := store.UpsertUser(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, created, req)
+
+	req.Email = "quinn.new@example.com"
+	req.LastName = "Provisioned"
+	req.Password = "provisioned"
+	updated, err := store.UpsertUser(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, updated, req)
+	if updated.HashedPassword != "" {
+		t.Error("UpsertUser must not return the password hash")
+	}
+
+	got, err := store.GetUserByUserName(ctx, req.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, got, req)
+	if err := util.CheckPassword(req.Password, got.HashedPassword); err != nil {
+		t.Errorf("stored hash does not match the new password: %v", err)
+	}
+
+	// A hash made before the call is stored as it is
+	hash, err := util.HashPassword("hashed-before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Password, req.HashedPassword = "", hash
+	if _, err := store.UpsertUser(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.GetUserByUserName(ctx, req.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HashedPassword != hash {
+		t.Errorf("stored hash %q, want the one passed in", got.HashedPassword)
+	}
+
+	// Emails stay unique across users
+	other := newUser("rupert")
+	other.Email = req.Email
+	_, err = store.UpsertUser(ctx, other)
+	if !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("got %v, want %v", err, db.ErrDuplicateEmail)
+	}
+}
+
+func testUpdateUser(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	req := newUser("erin")
+	mustCreateUser(t, store, req)
+
+	firstName, password := "Changed", "new-secret"
+	updated, err := store.UpdateUser(ctx, req.UserName, db.UserPatch{FirstName: &firstName, Password: &password})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := req
+	want.FirstName = firstName
+	checkUser(t, updated, want)
+	if updated.HashedPassword != "" {
+		t.Error("UpdateUser must not return the password hash")
+	}
+
+	// Only the fields in the patch change
+	got, err := store.GetUserByUserName(ctx, req.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, got, want)
+	if !got.CreatedAt.Equal(updated.CreatedAt) {
+		t.Errorf("created_at changed from %v to %v", updated.CreatedAt, got.CreatedAt)
+	}
+	if err := util.CheckPassword(password, got.HashedPassword); err != nil {
+		t.Errorf("stored hash does not match the new password: %v", err)
+	}
+
+	// An empty patch changes nothing
+	same, err := store.UpdateUser(ctx, req.UserName, db.UserPatch{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUser(t, same, want)
+
+	hash, err := util.HashPassword("hashed-before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UpdateUser(ctx, req.UserName, db.UserPatch{HashedPassword: &hash}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.GetUserByUserName(ctx, req.UserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HashedPassword != hash {
+		t.Errorf("stored hash %q, want the one passed in", got.HashedPassword)
+	}
+}
+
+func testUpdateUserNotFound(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	firstName := "Nobody"
+
+	_, err := store.UpdateUser(ctx, "nobody", db.UserPatch{FirstName: &firstName})
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrNotFound)
+	}
+
+	// and it must not have been created
+	_, err = store.GetUserByUserName(ctx, "nobody")
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrNotFound)
+	}
+}
+
+func testUpdateUserDuplicateEmail(t *testing.T, store db.Store) {
+	mustCreateUser(t, store, newUser("olivia"))
+	mustCreateUser(t, store, newUser("peggy"))
+
+	email := newUser("olivia").Email
+	_, err := store.UpdateUser(context.Background(), "peggy", db.UserPatch{Email: &email})
+	if !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("got %v, want %v", err, db.ErrDuplicateEmail)
+	}
+}
+
+func testGetUsers(t *testing.T, store db.Store) {
+	reqs := []db.UserRequest{newUser("frank"), newUser("grace"), newUser("heidi")}
+	for _, req := range reqs {
+		mustCreateUser(t, store, req)
+	}
+
+	page, err := store.GetUsers(context.Background(), db.ListUsersOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Users) != len(reqs) {
+		t.Fatalf("got %d users, want %d", len(page.Users), len(reqs))
+	}
+	if page.NextCursor != "" {
+		t.Errorf("got next cursor %q on the only page", page.NextCursor)
+	}
+
+	for i, got := range page.Users {
+		checkUser(t, got, reqs[i])
+		if got.HashedPassword != "" {
+			t.Errorf("GetUsers must not return password hashes, got one for %s", got.UserName)
+		}
+	}
+}
+
+// createPagingUsers creates five users whose emails sort the other way
+// round than their names, in an order that matches neither
+func createPagingUsers(t *testing.T, store db.Store) {
+	for _, i := range []int{3, 1, 5, 2, 4} {
+		req := newUser(fmt.Sprintf("page%d", i))
+		req.Email = fmt.Sprintf("%d-page@example.com", 6-i)
+		mustCreateUser(t, store, req)
+	}
+}
+
+// listAll follows next_cursor until the last page
+func listAll(t *testing.T, store db.Store, opts db.ListUsersOptions) []string {
+	t.Helper()
+
+	var names []string
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("GetUsers keeps returning a next cursor")
+		}
+
+		page, err := store.GetUsers(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Users) > opts.Limit {
+			t.Fatalf("got %d users, limit is %d", len(page.Users), opts.Limit)
+		}
+		for _, u := range page.Users {
+			names = append(names, u.UserName)
+		}
+
+		if page.NextCursor == "" {
+			return names
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func testGetUsersPages(t *testing.T, store db.Store) {
+	createPagingUsers(t, store)
+
+	tests := []struct {
+		sortBy db.UserSortField
+		desc   bool
+		want   string
+	}{
+		{"", false, "page1 page2 page3 page4 page5"},
+		{db.SortByUserName, true, "page5 page4 page3 page2 page1"},
+		{db.SortByEmail, false, "page5 page4 page3 page2 page1"},
+		{db.SortByEmail, true, "page1 page2 page3 page4 page5"},
+		{db.SortByCreatedAt, false, "page3 page1 page5 page2 page4"},
+		{db.SortByCreatedAt, true, "page4 page2 page5 page1 page3"},
+	}
+
+	for _, tc := range tests {
+		opts := db.ListUsersOptions{Limit: 2, SortBy: tc.sortBy, Desc: tc.desc}
+		got := strings.Join(listAll(t, store, opts), " ")
+		if got != tc.want {
+			t.Errorf("sort %q desc=%v: got %s, want %s", tc.sortBy, tc.desc, got, tc.want)
+		}
+	}
+}
+
+func testGetUsersFilters(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	createPagingUsers(t, store)
+	mustCreateUser(t, store, newUser("other"))
+
+	// created_at of page5, the third one created
+	page5, err := store.GetUserByUserName(ctx, "page5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page2, err := store.GetUserByUserName(ctx, "page2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts db.ListUsersOptions
+		want string
+	}{
+		{"user name prefix", db.ListUsersOptions{UserNamePrefix: "page"}, "page1 page2 page3 page4 page5"},
+		{"user name prefix is case sensitive", db.ListUsersOptions{UserNamePrefix: "PAGE"}, ""},
+		{"email prefix", db.ListUsersOptions{EmailPrefix: "2-"}, "page4"},
+		{"created after", db.ListUsersOptions{UserNamePrefix: "page", CreatedAfter: page5.CreatedAt, SortBy: db.SortByCreatedAt}, "page5 page2 page4"},
+		{"created before", db.ListUsersOptions{CreatedBefore: page5.CreatedAt, SortBy: db.SortByCreatedAt}, "page3 page1"},
+		{"created range", db.ListUsersOptions{CreatedAfter: page5.CreatedAt, CreatedBefore: page2.CreatedAt}, "page5"},
+		{"filter and paging", db.ListUsersOptions{UserNamePrefix: "page", Limit: 1, SortBy: db.SortByEmail}, "page5 page4 page3 page2 page1"},
+	}
+
+	for _, tc := range tests {
+		if tc.opts.Limit == 0 {
+			tc.opts.Limit = db.MaxUserPageSize
+		}
+		got := strings.Join(listAll(t, store, tc.opts), " ")
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func testGetUsersInvalidOptions(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	createPagingUsers(t, store)
+
+	_, err := store.GetUsers(ctx, db.ListUsersOptions{SortBy: "pass_hash"})
+	if !errors.Is(err, db.ErrInvalidSortField) {
+		t.Errorf("unknown sort field: got %v, want %v", err, db.ErrInvalidSortField)
+	}
+
+	_, err = store.GetUsers(ctx, db.ListUsersOptions{Cursor: "not a cursor"})
+	if !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("garbage cursor: got %v, want %v", err, db.ErrInvalidCursor)
+	}
+
+	page, err := store.GetUsers(ctx, db.ListUsersOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.GetUsers(ctx, db.ListUsersOptions{Limit: 2, Cursor: page.NextCursor, SortBy: db.SortByEmail})
+	if !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("cursor of another sort order: got %v, want %v", err, db.ErrInvalidCursor)
+	}
+}
+
+func newSession(userName string) db.SessionRequest {
+	id := uuid.New()
+	return db.SessionRequest{
+		ID:        id,
+		FamilyID:  id,
+		UserName:  userName,
+		TokenHash: "hash-" + id.String(),
+		UserAgent: "storetest",
+		ClientIP:  "127.0.0.1",
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Microsecond),
+	}
+}
+
+func testSessions(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	mustCreateUser(t, store, newUser("ivan"))
+
+	req := newSession("ivan")
+	created, err := store.CreateSession(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != req.ID || created.IsBlocked || created.ReplacedBy != nil {
+		t.Errorf("unexpected new session %+v", created)
+	}
+
+	got, err := store.GetSessionByTokenHash(ctx, req.TokenHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != req.ID || got.FamilyID != req.FamilyID || got.UserName != req.UserName || !got.ExpiresAt.Equal(req.ExpiresAt) {
+		t.Errorf("got session %+v, want %+v", got, req)
+	}
+
+	_, err = store.GetSessionByTokenHash(ctx, "unknown")
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, db.ErrNotFound)
+	}
+
+	_, err = store.CreateSession(ctx, newSession("nobody"))
+	if !errors.Is(err, db.ErrConstraintViolation) {
+		t.Errorf("session for unknown user: got %v, want %v", err, db.ErrConstraintViolation)
+	}
+}
+
+func testSessionReuse(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	mustCreateUser(t, store, newUser("judy"))
+
+	first, err := store.CreateSession(ctx, newSession("judy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nextReq := newSession("judy")
+	nextReq.FamilyID = first.FamilyID
+	next, err := store.CreateSession(ctx, nextReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ReplaceSession(ctx, first.ID, next.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ReplaceSession(ctx, first.ID, next.ID); !errors.Is(err, db.ErrSessionReused) {
+		t.Errorf("second ReplaceSession: got %v, want %v", err, db.ErrSessionReused)
+	}
+
+	if err := store.BlockSessionFamily(ctx, first.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetSessionByTokenHash(ctx, nextReq.TokenHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsBlocked {
+		t.Error("BlockSessionFamily did not block the newest session of the family")
+	}
+	if err := store.ReplaceSession(ctx, next.ID, uuid.New()); !errors.Is(err, db.ErrSessionReused) {
+		t.Errorf("ReplaceSession on blocked session: got %v, want %v", err, db.ErrSessionReused)
+	}
+}
+
+func testRevokeToken(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	expired, live := uuid.New(), uuid.New()
+
+	if err := store.RevokeToken(ctx, expired, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeToken(ctx, live, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// Revoking twice is fine
+	if err := store.RevokeToken(ctx, live, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := store.PruneRevokedTokens(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("pruned %d tokens, want 1", n)
+	}
+
+	for id, want := range map[uuid.UUID]bool{expired: false, live: true, uuid.New(): false} {
+		revoked, err := store.IsTokenRevoked(ctx, id, "nobody", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != want {
+			t.Errorf("IsTokenRevoked(%s) = %v, want %v", id, revoked, want)
+		}
+	}
+}
+
+func testRevokeUserTokens(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	// Whole seconds, every store keeps them exactly
+	cutoff := time.Now().UTC().Truncate(time.Second)
+
+	if err := store.RevokeUserTokens(ctx, "kim", cutoff, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// An older cutoff does not undo a newer one
+	if err := store.RevokeUserTokens(ctx, "kim", cutoff.Add(-time.Hour), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeUserTokens(ctx, "leo", cutoff, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		userName string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"kim", cutoff.Add(-time.Second), true},
+		{"kim", cutoff, false},
+		{"kim", cutoff.Add(time.Second), false},
+		{"mia", cutoff.Add(-time.Second), false},
+	}
+	for _, tt := range tests {
+		revoked, err := store.IsTokenRevoked(ctx, uuid.New(), tt.userName, tt.issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != tt.want {
+			t.Errorf("IsTokenRevoked(%s, %v) = %v, want %v", tt.userName, tt.issuedAt, revoked, tt.want)
+		}
+	}
+
+	n, err := store.PruneRevokedTokens(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("pruned %d entries, want 1", n)
+	}
+	revoked, err := store.IsTokenRevoked(ctx, uuid.New(), "kim", cutoff.Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("pruning dropped a revocation that has not expired")
+	}
+}
+
+func testBlockUserSessions(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	mustCreateUser(t, store, newUser("nina"))
+	mustCreateUser(t, store, newUser("omar"))
+
+	reqs := map[string]db.SessionRequest{
+		"nina first":  newSession("nina"),
+		"nina second": newSession("nina"),
+		"omar":        newSession("omar"),
+	}
+	for _, req := range reqs {
+		if _, err := store.CreateSession(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.BlockUserSessions(ctx, "nina"); err != nil {
+		t.Fatal(err)
+	}
+	for name, req := range reqs {
+		got, err := store.GetSessionByTokenHash(ctx, req.TokenHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := req.UserName == "nina"; got.IsBlocked != want {
+			t.Errorf("%s: IsBlocked = %v, want %v", name, got.IsBlocked, want)
+		}
+	}
+}
+
+func testExecTxCommit(t *testing.T, store db.Store) {
+	ctx := context.Background()
+
+	err := store.ExecTxOptions(ctx, db.TxOptions{IsoLevel: db.Serializable, MaxRetries: 1}, func(q db.Queries) error {
+		if _, err := q.CreateUser(ctx, newUser("kim")); err != nil {
+			return err
+		}
+		_, err := q.CreateSession(ctx, newSession("kim"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetUserByUserName(ctx, "kim"); err != nil {
+		t.Errorf("user created in a committed transaction is missing: %v", err)
+	}
+}
+
+func testExecTxRollback(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	mustCreateUser(t, store, newUser("lou"))
+	session := newSession("lou")
+	if _, err := store.CreateSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	tokenID := uuid.New()
+	now := time.Now()
+
+	err := store.ExecTx(ctx, func(q db.Queries) error {
+		if _, err := q.CreateUser(ctx, newUser("leo")); err != nil {
+			return err
+		}
+		if err := q.BlockUserSessions(ctx, "lou"); err != nil {
+			return err
+		}
+		if err := q.RevokeToken(ctx, tokenID, now.Add(time.Hour)); err != nil {
+			return err
+		}
+		if err := q.RevokeUserTokens(ctx, "lou", now, now.Add(time.Hour)); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("got %v, want %v", err, errBoom)
+	}
+
+	_, err = store.GetUserByUserName(ctx, "leo")
+	if !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("user created in a rolled back transaction: got %v, want %v", err, db.ErrNotFound)
+	}
+	got, err := store.GetSessionByTokenHash(ctx, session.TokenHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IsBlocked {
+		t.Error("session blocked in a rolled back transaction")
+	}
+	revoked, err := store.IsTokenRevoked(ctx, tokenID, "lou", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked {
+		t.Error("token revoked in a rolled back transaction")
+	}
+}
+
+func testContextCanceled(t *testing.T, store db.Store) {
+	mustCreateUser(t, store, newUser("mallory"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := store.GetUserByUserName(ctx, "mallory")
+	if !errors.Is(err, db.ErrQueryCanceled) {
+		t.Errorf("GetUserByUserName: got %v, want %v", err, db.ErrQueryCanceled)
+	}
+
+	_, err = store.GetUsers(ctx, db.ListUsersOptions{})
+	if !errors.Is(err, db.ErrQueryCanceled) {
+		t.Errorf("GetUsers: got %v, want %v", err, db.ErrQueryCanceled)
+	}
+
+	err = store.ExecTx(ctx, func(q db.Queries) error { return nil })
+	if !errors.Is(err, db.ErrQueryCanceled) {
+		t.Errorf("ExecTx: got %v, want %v", err, db.ErrQueryCanceled)
+	}
+}
+
+func testContextDeadline(t *testing.T, store db.Store) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err := store.GetUserByEmail(ctx, "nobody@example.com")
+	if !errors.Is(err, db.ErrQueryTimeout) {
+		t.Errorf("got %v, want %v", err, db.ErrQueryTimeout)
+	}
+}
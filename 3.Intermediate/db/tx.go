@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// IsoLevel is a transaction isolation level
+type IsoLevel string
+
+// Isolation levels, spelled the way Postgres spells them
+const (
+	ReadCommitted  IsoLevel = "read committed"
+	RepeatableRead IsoLevel = "repeatable read"
+	Serializable   IsoLevel = "serializable"
+)
+
+// TxOptions ...
+type TxOptions struct {
+	IsoLevel IsoLevel
+	// MaxRetries is how often the transaction is run again after a
+	// serialization failure or a deadlock
+	MaxRetries int
+}
+
+// DefaultTxOptions is what ExecTx uses
+var DefaultTxOptions = TxOptions{
+	IsoLevel:   ReadCommitted,
+	MaxRetries: 3,
+}
+
+const txRetryBackoff = 10 * time.Millisecond
+
+// Postgres error codes that mean "run it again"
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// ExecTx ..
+func (pg *PGStore) ExecTx(ctx context.Context, fn func(q Queries) error) error {
+	return pg.ExecTxOptions(ctx, DefaultTxOptions, fn)
+}
+
+// ExecTxOptions ..
+func (pg *PGStore) ExecTxOptions(ctx context.Context, opts TxOptions, fn func(q Queries) error) error {
+	if pg.pool == nil {
+		return errors.New("nested transactions are not supported")
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := pg.execTx(ctx, opts, fn)
+		if err == nil || attempt >= opts.MaxRetries || !isRetryable(err) {
+			return err
+		}
+
+		l.D("retrying transaction", attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return pgError(ctx, ctx.Err())
+		case <-time.After(txRetryBackoff * time.Duration(attempt+1)):
+		}
+	}
+}
+
+func (pg *PGStore) execTx(ctx context.Context, opts TxOptions, fn func(q Queries) error) (err error) {
+	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.TxIsoLevel(opts.IsoLevel)})
+	if err != nil {
+		return pgError(ctx, err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	err = fn(&PGStore{db: tx})
+	if err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("tx err: %w, rollback err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return pgError(ctx, tx.Commit(ctx))
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Page sizes for GetUsers
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 100
+)
+
+var (
+	// ErrInvalidCursor means the cursor was not made by GetUsers, or was
+	// made for a different sort order
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSortField means GetUsers cannot sort by the field asked for
+	ErrInvalidSortField = errors.New("invalid sort field")
+)
+
+// UserSortField is a column GetUsers can sort by
+type UserSortField string
+
+// Sort fields, anything else is refused so user input never reaches the SQL
+const (
+	SortByUserName  UserSortField = "user_name"
+	SortByEmail     UserSortField = "email"
+	SortByCreatedAt UserSortField = "created_at"
+)
+
+// Valid reports whether GetUsers can sort by f
+func (f UserSortField) Valid() bool {
+	switch f {
+	case SortByUserName, SortByEmail, SortByCreatedAt:
+		return true
+	}
+	return false
+}
+
+// ListUsersOptions selects a page of users. Zero values mean no filter.
+type ListUsersOptions struct {
+	// Limit defaults to DefaultUserPageSize and is capped at MaxUserPageSize
+	Limit int
+	// Cursor is the NextCursor of the previous page. Filters and sort order
+	// must be the same as for that page.
+	Cursor         string
+	UserNamePrefix string
+	EmailPrefix    string
+	// CreatedAfter is inclusive, CreatedBefore is exclusive
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// SortBy defaults to SortByUserName, ties are broken by user name
+	SortBy UserSortField
+	Desc   bool
+}
+
+// UserPage ...
+type UserPage struct {
+	Users []UserResponse `json:"users"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// userCursor is the position after the last user of a page. It is sent to
+// clients as base64 JSON; they are not meant to look inside.
+type userCursor struct {
+	SortBy UserSortField `json:"s"`
+	Desc   bool          `json:"d,omitempty"`
+	// Value is the sort field of the last user, created_at in RFC 3339
+	Value    string `json:"v"`
+	UserName string `json:"u"`
+}
+
+func (c userCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// userListQuery is ListUsersOptions with the defaults and the cursor applied
+type userListQuery struct {
+	ListUsersOptions
+	after *userCursor
+	// afterTime is after.Value parsed, when sorting by created_at
+	afterTime time.Time
+}
+
+func newUserListQuery(opts ListUsersOptions) (userListQuery, error) {
+	q := userListQuery{ListUsersOptions: opts}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultUserPageSize
+	}
+	if q.Limit > MaxUserPageSize {
+		q.Limit = MaxUserPageSize
+	}
+	if q.SortBy == "" {
+		q.SortBy = SortByUserName
+	}
+	if !q.SortBy.Valid() {
+		return userListQuery{}, fmt.Errorf("%w: %q", ErrInvalidSortField, q.SortBy)
+	}
+
+	if q.Cursor == "" {
+		return q, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return userListQuery{}, ErrInvalidCursor
+	}
+	var c userCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.UserName == "" {
+		return userListQuery{}, ErrInvalidCursor
+	}
+	if c.SortBy != q.SortBy || c.Desc != q.Desc {
+		return userListQuery{}, fmt.Errorf("%w: it belongs to another sort order", ErrInvalidCursor)
+	}
+	if c.SortBy == SortByCreatedAt {
+		if q.afterTime, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return userListQuery{}, ErrInvalidCursor
+		}
+	}
+	q.after = &c
+
+	return q, nil
+}
+
+// sql builds the select for GetUsers. Postgres and SQLite only differ in
+// how they number parameters and how they test for a prefix. One more row
+// than the limit is asked for to find out whether there is a next page.
+func (q userListQuery) sql(param func(n int) string, startsWith func(column string, prefix string) string) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return param(len(args))
+	}
+
+	if q.UserNamePrefix != "" {
+		where = append(where, startsWith("user_name", arg(q.UserNamePrefix)))
+	}
+	if q.EmailPrefix != "" {
+		where = append(where, startsWith("email", arg(q.EmailPrefix)))
+	}
+	if !q.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(q.CreatedAfter.UTC()))
+	}
+	if !q.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(q.CreatedBefore.UTC()))
+	}
+
+	op, dir := ">", "asc"
+	if q.Desc {
+		op, dir = "<", "desc"
+	}
+
+	if q.after != nil {
+		if q.SortBy == SortByUserName {
+			where = append(where, fmt.Sprintf("user_name %s %s", op, arg(q.after.UserName)))
+		} else {
+			var value interface{} = q.after.Value
+			if q.SortBy == SortByCreatedAt {
+				value = q.afterTime.UTC()
+			}
+			where = append(where, fmt.Sprintf("(%s, user_name) %s (%s, %s)", q.SortBy, op, arg(value), arg(q.after.UserName)))
+		}
+	}
+
+	sql := "select user_name, first_name, last_name, email, created_at, roles, scopes from users"
+	if len(where) > 0 {
+		sql += " where " + strings.Join(where, " and ")
+	}
+	sql += fmt.Sprintf(" order by %s %s", q.SortBy, dir)
+	if q.SortBy != SortByUserName {
+		sql += fmt.Sprintf(", user_name %s", dir)
+	}
+	sql += " limit " + arg(q.Limit+1)
+
+	return sql, args
+}
+
+// match reports whether u passes the filters and comes after the cursor,
+// for stores that filter in Go
+func (q userListQuery) match(u UserResponse) bool {
+	if !strings.HasPrefix(u.UserName, q.UserNamePrefix) || !strings.HasPrefix(u.Email, q.EmailPrefix) {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && u.CreatedAt.Before(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !u.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+	if q.after == nil {
+		return true
+	}
+
+	c := q.compareCursor(u)
+	return c > 0 && !q.Desc || c < 0 && q.Desc
+}
+
+// compareCursor compares u to the cursor in ascending order
+func (q userListQuery) compareCursor(u UserResponse) int {
+	var c int
+	switch q.SortBy {
+	case SortByEmail:
+		c = strings.Compare(u.Email, q.after.Value)
+	case SortByCreatedAt:
+		c = compareTimes(u.CreatedAt, q.afterTime)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(u.UserName, q.after.UserName)
+}
+
+// less orders users the way the query asks for, for stores that sort in Go
+func (q userListQuery) less(a UserResponse, b UserResponse) bool {
+	var c int
+	switch q.SortBy {
+	case SortByEmail:
+		c = strings.Compare(a.Email, b.Email)
+	case SortByCreatedAt:
+		c = compareTimes(a.CreatedAt, b.CreatedAt)
+	}
+	if c == 0 {
+		c = strings.Compare(a.UserName, b.UserName)
+	}
+	if q.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+func compareTimes(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// page cuts users, sorted and with at most Limit+1 entries, down to one
+// page and sets the cursor when there is more
+func (q userListQuery) page(users []UserResponse) UserPage {
+	if len(users) <= q.Limit {
+		return UserPage{Users: users}
+	}
+
+	users = users[:q.Limit]
+	last := users[len(users)-1]
+	c := userCursor{SortBy: q.SortBy, Desc: q.Desc, UserName: last.UserName}
+	switch q.SortBy {
+	case SortByEmail:
+		c.Value = last.Email
+	case SortByCreatedAt:
+		c.Value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return UserPage{Users: users, NextCursor: c.encode()}
+}
@@ -6,6 +6,8 @@ create table users (
 	last_name varchar(40) not null,
 	email varchar not null,
 	pass_hash varchar not null,  
+	roles varchar[] not null DEFAULT '{}',
+	scopes varchar[] not null DEFAULT '{}',
 	created_at timestamptz not null DEFAULT (now()),
 	
 	unique(email)
@@ -9,12 +9,15 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
 )
 
 type level int
 
-// If you leave logLevel without any default value then its value is 0 or TRACE
-var logLevel level
+// If you leave logLevel without any default value then its value is 0 or TRACE.
+// It holds a level and is accessed atomically, so it can change while other
+// goroutines log.
+var logLevel int32
 
 // Do we even need these many levels? Whats the purpose? Think about it! Lets keep things simple
 const (
@@ -32,9 +35,31 @@ const (
 	FATAL
 )
 
+// levelNames are the names ParseLevel accepts
+var levelNames = map[string]level{
+	"trace": TRACE,
+	"debug": DEBUG,
+	"info":  INFO,
+	"warn":  WARN,
+	"error": ERROR,
+}
+
 // SetLogLevel ...
 func SetLogLevel(l level) {
-	logLevel = l
+	atomic.StoreInt32(&logLevel, int32(l))
+}
+
+// ParseLevel returns the level named by name, e.g. "debug", in any case
+func ParseLevel(name string) (level, error) {
+	l, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q, use trace, debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+func enabled(l level) bool {
+	return level(atomic.LoadInt32(&logLevel)) <= l
 }
 
 // LType ...
@@ -146,7 +171,7 @@ func SetFileLogger(fileName string, l level, fileDir ...string) {
 
 // T is a trace logger
 func T(v ...interface{}) {
-	if int(logLevel) <= int(TRACE) {
+	if enabled(TRACE) {
 		logger.SetPrefix("TRACE: ")
 		printStackTrace(2, v...)
 	}
@@ -154,7 +179,7 @@ func T(v ...interface{}) {
 
 // D is a debug logger
 func D(v ...interface{}) {
-	if int(logLevel) <= int(DEBUG) {
+	if enabled(DEBUG) {
 		logger.SetPrefix("DEBUG: ")
 		printStackTrace(2, v...)
 	}
@@ -162,7 +187,7 @@ func D(v ...interface{}) {
 
 // I is a Info logger
 func I(v ...interface{}) {
-	if int(logLevel) <= int(INFO) {
+	if enabled(INFO) {
 		logger.SetPrefix("INFO: ")
 		printStackTrace(2, v...)
 	}
@@ -170,7 +195,7 @@ func I(v ...interface{}) {
 
 // W is a warn logger
 func W(v ...interface{}) {
-	if int(logLevel) <= int(WARN) {
+	if enabled(WARN) {
 		logger.SetPrefix("WARNING: ")
 		printStackTrace(2, v...)
 	}
@@ -178,7 +203,7 @@ func W(v ...interface{}) {
 
 // E is an error logger
 func E(v ...interface{}) {
-	if int(logLevel) <= int(ERROR) {
+	if enabled(ERROR) {
 		logger.SetPrefix("ERROR: ")
 		printStackTrace(10, v...)
 	}
@@ -186,7 +211,7 @@ func E(v ...interface{}) {
 
 // F is a fatal logger
 func F(v ...interface{}) {
-	if int(logLevel) <= int(FATAL) {
+	if enabled(FATAL) {
 		logger.SetPrefix("FATAL: ")
 		printStackTrace(10, v...)
 		os.Exit(99)
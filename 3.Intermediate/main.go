@@ -5,18 +5,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/api"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
 	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
 	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
-	"github.com/jackc/pgx/v4"
+	"github.com/spf13/pflag"
 )
 
 func helo() {
@@ -102,57 +105,81 @@ func simplePOSTRequest() {
 	fmt.Println("Client >> Response", string(readerData))
 }
 
-func testServer(config util.Config) {
+// testServer serves HTTP until SIGINT or SIGTERM. It then stops taking new
+// requests, gives the ones in flight SHUTDOWN_TIMEOUT to finish, closes the
+// store and flushes the logs, in that order. A second signal stops the
+// process right away.
+func testServer(loader *util.ConfigLoader, config util.Config) {
 	var err error
 
-	bgCtx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	conn, err := pgx.Connect(bgCtx, config.DBSource)
+	// A signal also ends the wait for another instance's migration lock
+	store, err := db.NewStore(ctx, config)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Unable to open store: %v\n", err)
 		os.Exit(1)
 	}
-	defer conn.Close(bgCtx)
 
-	store := db.NewPGStore(conn)
-
-	server, err := api.NewServer(store)
+	server, err := api.NewServer(config, store)
 	if err != nil {
+		store.Close()
 		log.Fatal("Failed to create server", err)
 	}
-
-	err = server.Start(":5555")
-	if err != nil {
-		log.Fatal("Failed to start server", err)
+	go watchConfig(ctx, loader, server, config)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Start()
+	}()
+
+	select {
+	case err = <-serveErr:
+		if err != nil {
+			store.Close()
+			log.Fatal("Failed to start server", err)
+		}
+	case <-ctx.Done():
+		stop()
+		l.I("shutting down, waiting up to", config.ShutdownTimeout, "for requests in flight")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			l.E("requests cut off by shutdown", err)
+		}
+		<-serveErr
 	}
+
+	store.Close()
+	l.I("server stopped")
+	l.CleanUp()
 }
 
 func testDB(config util.Config) {
 	var err error
 
-	conn, err := pgx.Connect(context.Background(), config.DBSource)
+	store, err := db.NewStore(context.Background(), config)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Unable to open store: %v\n", err)
 		os.Exit(1)
 	}
-	defer conn.Close(context.Background())
-
-	store := db.NewPGStore(conn)
+	defer store.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
 	// ur, err := store.GetUserByEmail(context.Background(), "a@b.com")
-	ur, err := store.UpdateUser(ctx, db.UserRequest{
-		FirstName: "aa",
-		LastName:  "bb",
-		UserName:  "aabb",
-		Email:     "aa@bb.com",
+	firstName, email := "aa", "aa@bb.com"
+	ur, err := store.UpdateUser(ctx, "aabb", db.UserPatch{
+		FirstName: &firstName,
+		Email:     &email,
 	})
 	b, _ := json.Marshal(ur)
 	fmt.Printf("%+v %v \n", ur, err)
 	fmt.Printf("%v \n", string(b))
 
-	fmt.Println(store.GetUsers(ctx))
+	fmt.Println(store.GetUsers(ctx, db.ListUsersOptions{}))
 }
 
 // -trimpath will cut short file name everywhere in our code when displaying
@@ -175,14 +202,42 @@ func main() {
 	// }()
 	// startServer()
 
-	config, err := util.LoadConfig(".")
+	loader, err := util.NewConfigLoader(".", os.Args[1:])
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal("cannot load config:", err)
+		log.Fatal("cannot parse flags: ", err)
+	}
+
+	config, err := loader.Load()
+	if err != nil {
+		log.Fatal("cannot load config: ", err)
+	}
+
+	args := loader.Args()
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfig(config, args[1:]); err != nil {
+			log.Fatal("config: ", err)
+		}
+		return
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	applyLogLevel(config)
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(config, args[1:]); err != nil {
+			log.Fatal("migrate: ", err)
+		}
+		return
 	}
 
-	fmt.Printf("%+v", config)
+	l.D("effective config\n", config)
 
 	// testDB(config)
-	testServer(config)
+	testServer(loader, config)
 
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/db"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+const migrateUsage = `usage: app migrate <command>
+
+  up             apply every pending migration
+  down [N]       roll back the last N migrations, 1 by default
+  status         show the schema version and the known migrations
+  force VERSION  set the schema version without running anything,
+                 after a failed migration was fixed by hand (0 = none)`
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// runMigrate runs the migrate subcommand against the Postgres database in
+// DB_SOURCE. The server applies pending migrations by itself on startup,
+// this is for rolling back and repairing.
+func runMigrate(config util.Config, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	if config.DBDriver != "" && config.DBDriver != db.DriverPostgres {
+		return fmt.Errorf("migrate works on postgres only, DB_DRIVER is %q", config.DBDriver)
+	}
+
+	// Waiting for the migration lock can take a while, let a signal end it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pool, err := db.NewPGPool(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	migrator, err := db.NewPGMigrator(pool)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+		return migrator.Down(ctx, steps)
+
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(status)
+		return nil
+
+	case "force":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return errMigrateUsage
+		}
+		return migrator.Force(ctx, uint(version))
+
+	default:
+		return errMigrateUsage
+	}
+}
+
+func printMigrationStatus(status db.MigrationStatus) {
+	fmt.Printf("version %d of %d", status.Version, status.Latest)
+	if status.Dirty {
+		fmt.Print(" (dirty)")
+	}
+	if status.Version > status.Latest {
+		fmt.Print(" (ahead of this build)")
+	}
+	fmt.Println()
+
+	for _, m := range status.Migrations {
+		state := "pending"
+		if m.Applied {
+			state = "applied"
+		}
+		fmt.Printf("  %06d  %-20s %s\n", m.Version, m.Name, state)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/api"
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+// applyLogLevel sets the log level of a validated config
+func applyLogLevel(config util.Config) {
+	level, err := l.ParseLevel(config.LogLevel)
+	if err != nil {
+		l.E(err)
+		return
+	}
+	l.SetLogLevel(level)
+}
+
+// watchConfig applies the log level, rate limits and token TTLs of every
+// config reload until ctx is done. Changes to other settings are reported,
+// they need a restart. config is the config the server started with.
+func watchConfig(ctx context.Context, loader *util.ConfigLoader, server *api.Server, config util.Config) {
+	err := loader.Watch(ctx, func(newConfig util.Config, err error) {
+		if err != nil {
+			l.E("config not reloaded", err)
+			return
+		}
+
+		applyLogLevel(newConfig)
+		server.Reload(newConfig)
+		for _, key := range util.RestartRequired(config, newConfig) {
+			l.W(key, "changed, restart to apply it")
+		}
+		l.I("config reloaded")
+	})
+	if err != nil {
+		l.E("cannot watch config", err)
+	}
+}
@@ -0,0 +1,155 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Option configures the registered claims a tokener issues and expects
+type Option func(*claimsConfig)
+
+type claimsConfig struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// WithIssuer sets the iss claim on new tokens and rejects tokens from anyone else
+func WithIssuer(issuer string) Option {
+	return func(c *claimsConfig) {
+		c.issuer = issuer
+	}
+}
+
+// WithAudience sets the aud claim on new tokens and rejects tokens meant for
+// another service
+func WithAudience(audience string) Option {
+	return func(c *claimsConfig) {
+		c.audience = audience
+	}
+}
+
+// WithLeeway allows for clock skew between the issuing and the verifying host
+// when checking exp and nbf
+func WithLeeway(leeway time.Duration) Option {
+	return func(c *claimsConfig) {
+		c.leeway = leeway
+	}
+}
+
+// WithClock replaces time.Now, mostly useful in tests
+func WithClock(now func() time.Time) Option {
+	return func(c *claimsConfig) {
+		c.now = now
+	}
+}
+
+func newClaimsConfig(opts []Option) claimsConfig {
+	c := claimsConfig{now: time.Now}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c claimsConfig) newPayload(identity Identity, duration time.Duration) (*Payload, error) {
+	payload, err := newPayload(identity, duration, c.now())
+	if err != nil {
+		return nil, err
+	}
+
+	payload.Issuer = c.issuer
+	if c.audience != "" {
+		payload.Audience = Audience{c.audience}
+	}
+	return payload, nil
+}
+
+func (c claimsConfig) validate(payload *Payload) error {
+	now := c.now()
+
+	if now.After(payload.ExpiredAt.Time.Add(c.leeway)) {
+		return ErrExpiredToken
+	}
+	if !payload.NotBefore.IsZero() && now.Add(c.leeway).Before(payload.NotBefore.Time) {
+		return ErrInvalidToken
+	}
+	if c.issuer != "" && payload.Issuer != c.issuer {
+		return ErrInvalidToken
+	}
+	if c.audience != "" && !payload.Audience.Contains(c.audience) {
+		return ErrInvalidToken
+	}
+	if payload.Subject == "" || payload.Subject != payload.Username {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+var errInvalidAudience = errors.New("aud must be a string or an array of strings")
+
+// Audience is the aud claim. RFC 7519 allows a single string or an array;
+// a single audience is written as a string.
+type Audience []string
+
+// Contains reports whether aud names audience
+func (aud Audience) Contains(audience string) bool {
+	return contains(aud, audience)
+}
+
+// MarshalJSON implements json.Marshaler
+func (aud Audience) MarshalJSON() ([]byte, error) {
+	if len(aud) == 1 {
+		return json.Marshal(aud[0])
+	}
+	return json.Marshal([]string(aud))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (aud *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errInvalidAudience
+	}
+	*aud = list
+	return nil
+}
+
+// NumericDate is a time written as seconds since the epoch, which is how
+// RFC 7519 encodes exp, nbf and iat. The zero time is written as null.
+type NumericDate struct {
+	time.Time
+}
+
+// MarshalJSON implements json.Marshaler
+func (d NumericDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.FormatInt(d.Unix(), 10)), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Fractions of a second are
+// accepted, as the RFC allows them.
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = NumericDate{}
+		return nil
+	}
+
+	seconds, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return errors.New("NumericDate must be a number of seconds")
+	}
+	*d = NumericDate{time.Unix(0, int64(seconds*float64(time.Second)))}
+	return nil
+}
@@ -0,0 +1,134 @@
+package token
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// t0 is a whole second, NumericDates have no finer resolution on the wire
+var t0 = time.Unix(1600000000, 0)
+
+func clockAt(t time.Time) Option {
+	return WithClock(func() time.Time { return t })
+}
+
+func TestClaimsExpiryAndNotBefore(t *testing.T) {
+	issuer, err := NewJWTToken(testSymmetricKey, clockAt(t0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := issuer.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		leeway time.Duration
+		want   error
+	}{
+		{"at nbf", t0, 0, nil},
+		{"before nbf", t0.Add(-time.Second), 0, ErrInvalidToken},
+		{"before nbf within leeway", t0.Add(-5 * time.Second), 5 * time.Second, nil},
+		{"before nbf beyond leeway", t0.Add(-6 * time.Second), 5 * time.Second, ErrInvalidToken},
+		{"at exp", t0.Add(time.Minute), 0, nil},
+		{"after exp", t0.Add(time.Minute + time.Nanosecond), 0, ErrExpiredToken},
+		{"after exp within leeway", t0.Add(time.Minute + 5*time.Second), 5 * time.Second, nil},
+		{"after exp beyond leeway", t0.Add(time.Minute + 5*time.Second + time.Nanosecond), 5 * time.Second, ErrExpiredToken},
+	}
+	for _, tt := range tests {
+		verifier, err := NewJWTToken(testSymmetricKey, clockAt(tt.now), WithLeeway(tt.leeway))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifier.VerifyToken(token); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestClaimsIssuerAudienceSubject(t *testing.T) {
+	opts := []Option{WithIssuer("go-training"), WithAudience("go-training-api"), clockAt(t0)}
+	verifier, err := NewJWTToken(testSymmetricKey, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(change func(p *Payload)) string {
+		t.Helper()
+		p, err := newClaimsConfig(opts).newPayload(testIdentity, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change(p)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, p).SignedString([]byte(testSymmetricKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *Payload)
+		want   error
+	}{
+		{"as issued", func(p *Payload) {}, nil},
+		{"audience list", func(p *Payload) { p.Audience = Audience{"billing", "go-training-api"} }, nil},
+		{"wrong issuer", func(p *Payload) { p.Issuer = "someone-else" }, ErrInvalidToken},
+		{"no issuer", func(p *Payload) { p.Issuer = "" }, ErrInvalidToken},
+		{"wrong audience", func(p *Payload) { p.Audience = Audience{"billing"} }, ErrInvalidToken},
+		{"no audience", func(p *Payload) { p.Audience = nil }, ErrInvalidToken},
+		{"other subject", func(p *Payload) { p.Subject = "bob" }, ErrInvalidToken},
+		{"no subject", func(p *Payload) { p.Subject = "" }, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		if _, err := verifier.VerifyToken(sign(tt.change)); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRegisteredClaimsEncoding(t *testing.T) {
+	p, err := newClaimsConfig([]Option{WithAudience("go-training-api"), clockAt(t0)}).newPayload(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for claim, want := range map[string]time.Time{"nbf": t0, "iat": t0, "exp": t0.Add(time.Minute)} {
+		if raw[claim] != float64(want.Unix()) {
+			t.Errorf("%s is %#v, want the NumericDate %d", claim, raw[claim], want.Unix())
+		}
+	}
+	if raw["aud"] != "go-training-api" {
+		t.Errorf("a single aud is %#v, want a string", raw["aud"])
+	}
+
+	// Claims from other issuers
+	var other Payload
+	if err := json.Unmarshal([]byte(`{"aud":["a","b"],"nbf":1600000000.5}`), &other); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(other.Audience, Audience{"a", "b"}) || !other.NotBefore.Equal(t0.Add(500*time.Millisecond)) {
+		t.Errorf("got aud %v, nbf %v", other.Audience, other.NotBefore)
+	}
+
+	for _, bad := range []string{`{"aud":1}`, `{"nbf":"2020-09-13T12:26:40Z"}`} {
+		if err := json.Unmarshal([]byte(bad), &Payload{}); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
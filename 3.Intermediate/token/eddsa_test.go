@@ -0,0 +1,72 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func newEdKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEdDSASignVerify(t *testing.T) {
+	key := newEdKey(t)
+
+	sig, err := SigningMethodEd25519.Sign("header.payload", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SigningMethodEd25519.Verify("header.payload", sig, key.Public()); err != nil {
+		t.Errorf("own signature: %v", err)
+	}
+	if err := SigningMethodEd25519.Verify("header.payloaD", sig, key.Public()); err == nil {
+		t.Error("changed input verified")
+	}
+	if err := SigningMethodEd25519.Verify("header.payload", sig, newEdKey(t).Public()); err == nil {
+		t.Error("other key verified")
+	}
+
+	if _, err := SigningMethodEd25519.Sign("header.payload", newECKey(t)); err != jwt.ErrInvalidKeyType {
+		t.Errorf("signing with an EC key: got %v", err)
+	}
+	if err := SigningMethodEd25519.Verify("header.payload", sig, []byte("secret")); err != jwt.ErrInvalidKeyType {
+		t.Errorf("verifying with a secret: got %v", err)
+	}
+}
+
+func TestEdDSAKeyRingToken(t *testing.T) {
+	ring := newTestKeyRing(t, "ed", newEdKey(t))
+	maker, err := NewJWTKeyRingToken(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := maker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &Payload{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("signed with %s", parsed.Method.Alg())
+	}
+
+	payload, err := maker.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Username != "alice" {
+		t.Errorf("got %+v", payload)
+	}
+}
@@ -0,0 +1,178 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// JWK is a single public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyPublisher is implemented by tokeners whose verification keys can be shared
+type KeyPublisher interface {
+	// JWKS returns the public keys, ok is false when there is nothing to publish
+	JWKS() (keys JWKS, ok bool)
+}
+
+// JWKS implements KeyPublisher. HMAC tokens have no public keys.
+func (maker *JWTToken) JWKS() (JWKS, bool) {
+	if maker.keys == nil {
+		return JWKS{}, false
+	}
+	return maker.keys.JWKS(), true
+}
+
+// JWKS returns the current and all previous verification keys.
+// The current signing key always comes first.
+func (ring *KeyRing) JWKS() JWKS {
+	ids := make([]string, 0, len(ring.verify))
+	for id := range ring.verify {
+		if id != ring.signing.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{ring.signing.ID}, ids...)
+
+	set := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		key := ring.verify[id]
+		jwk, err := newJWK(key)
+		if err != nil {
+			// LoadKeyRing only accepts key types we can encode
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func newJWK(key VerificationKey) (JWK, error) {
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+	switch k := key.Key.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeBigInt(k.N, 0)
+		jwk.E = encodeBigInt(big.NewInt(int64(k.E)), 0)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = k.Curve.Params().Name
+		jwk.X = encodeBigInt(k.X, size)
+		jwk.Y = encodeBigInt(k.Y, size)
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", key.Key)
+	}
+	return jwk, nil
+}
+
+// VerificationKey converts the JWK back into a key that can verify tokens
+func (jwk JWK) VerificationKey() (VerificationKey, error) {
+	var publicKey crypto.PublicKey
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return VerificationKey{}, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return VerificationKey{}, err
+		}
+		publicKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return VerificationKey{}, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return VerificationKey{}, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return VerificationKey{}, err
+		}
+		publicKey = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return VerificationKey{}, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return VerificationKey{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return VerificationKey{}, errors.New("invalid Ed25519 key size")
+		}
+		publicKey = ed25519.PublicKey(x)
+	default:
+		return VerificationKey{}, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+
+	method, err := signingMethodFor(publicKey)
+	if err != nil {
+		return VerificationKey{}, err
+	}
+	if jwk.Algorithm != "" && jwk.Algorithm != method.Alg() {
+		return VerificationKey{}, fmt.Errorf("algorithm %q does not match %s key", jwk.Algorithm, jwk.KeyType)
+	}
+
+	return VerificationKey{ID: jwk.KeyID, Method: method, Key: publicKey}, nil
+}
+
+func encodeBigInt(i *big.Int, size int) string {
+	b := i.Bytes()
+	if len(b) < size {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		b = padded
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,204 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKRoundTrip(t *testing.T) {
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]crypto.Signer{
+		"RS256": newRSAKey(t),
+		"ES256": newECKey(t),
+		"ES384": p384,
+		"EdDSA": newEdKey(t),
+	}
+	for alg, private := range keys {
+		method, err := signingMethodFor(private.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk, err := newJWK(VerificationKey{ID: "k1", Method: method, Key: private.Public()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(JWKS{Keys: []JWK{jwk}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var set JWKS
+		if err := json.Unmarshal(b, &set); err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := set.Keys[0].VerificationKey()
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		public := private.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if key.ID != "k1" || key.Method.Alg() != alg || !public.Equal(key.Key) {
+			t.Errorf("%s: got %s %s %v", alg, key.ID, key.Method.Alg(), key.Key)
+		}
+
+		// The alg of a key cannot be swapped for another one
+		jwk.Algorithm = "HS256"
+		if _, err := jwk.VerificationKey(); err == nil {
+			t.Errorf("%s key accepted with alg HS256", alg)
+		}
+	}
+}
+
+func TestKeyRingJWKSOrder(t *testing.T) {
+	old := newTestKeyRing(t, "a-old", newECKey(t))
+	oldKey, _ := old.VerificationKey("a-old")
+	ring := newTestKeyRing(t, "z-current", newEdKey(t), oldKey)
+
+	set := ring.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].KeyID != "z-current" || set.Keys[1].KeyID != "a-old" {
+		t.Errorf("got %+v", set.Keys)
+	}
+}
+
+func writeKeySet(t *testing.T, file string, ring *KeyRing) {
+	t.Helper()
+	b, err := json.Marshal(ring.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSVerifierFileKeySet(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "jwks.json")
+
+	ring := newTestKeyRing(t, "2021-01", newECKey(t))
+	maker, err := NewJWTKeyRingToken(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeySet(t, file, ring)
+
+	verifier := NewJWKSVerifier(FileKeySet{Path: file}, time.Hour)
+	token, err := maker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// The issuer rotates. Right after a fetch an unknown kid is refused
+	// without asking again...
+	oldKey, _ := ring.VerificationKey("2021-01")
+	rotated := newTestKeyRing(t, "2021-02", newRSAKey(t), oldKey)
+	rotatedMaker, err := NewJWTKeyRingToken(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeySet(t, file, rotated)
+	newToken, err := rotatedMaker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyToken(newToken); err != ErrInvalidToken {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+
+	// ...and once minJWKSRefetchInterval has passed the new key is fetched
+	verifier.mu.Lock()
+	verifier.fetchedAt = time.Now().Add(-minJWKSRefetchInterval - time.Second)
+	verifier.mu.Unlock()
+	if _, err := verifier.VerifyToken(newToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.VerifyToken(token); err != nil {
+		t.Errorf("token signed before the rotation: %v", err)
+	}
+}
+
+// failingKeySet fails every fetch. Fetches block until release is closed.
+type failingKeySet struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (src *failingKeySet) KeySet(ctx context.Context) (JWKS, error) {
+	atomic.AddInt32(&src.calls, 1)
+	<-src.release
+	return JWKS{}, errors.New("key server is down")
+}
+
+func TestJWKSVerifierBacksOff(t *testing.T) {
+	ring := newTestKeyRing(t, "k1", newECKey(t))
+	maker, err := NewJWTKeyRingToken(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := maker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &failingKeySet{release: make(chan struct{})}
+	verifier := NewJWKSVerifier(src, time.Hour)
+
+	// Concurrent requests share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := verifier.VerifyToken(token); err != ErrInvalidToken {
+				t.Errorf("got %v, want ErrInvalidToken", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(src.release)
+	wg.Wait()
+	if calls := atomic.LoadInt32(&src.calls); calls != 1 {
+		t.Fatalf("%d fetches for concurrent requests, want 1", calls)
+	}
+
+	// Requests after the failure don't hit the key server again
+	for i := 0; i < 10; i++ {
+		verifier.VerifyToken(token)
+	}
+	if calls := atomic.LoadInt32(&src.calls); calls != 1 {
+		t.Fatalf("%d fetches while backing off, want 1", calls)
+	}
+
+	// Once the backoff is over one more fetch is made, and the next wait
+	// is longer
+	verifier.mu.Lock()
+	verifier.retryAt = time.Now()
+	verifier.mu.Unlock()
+	verifier.VerifyToken(token)
+	if calls := atomic.LoadInt32(&src.calls); calls != 2 {
+		t.Fatalf("%d fetches after the backoff, want 2", calls)
+	}
+	verifier.mu.RLock()
+	wait := time.Until(verifier.retryAt)
+	verifier.mu.RUnlock()
+	if wait <= jwksRetryBackoff || wait > 2*jwksRetryBackoff {
+		t.Errorf("second backoff is %v, want about %v", wait, 2*jwksRetryBackoff)
+	}
+}
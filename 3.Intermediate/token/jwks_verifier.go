@@ -0,0 +1,204 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	l "github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultJWKSRefreshInterval is how long fetched keys are trusted before they are fetched again
+const DefaultJWKSRefreshInterval = 10 * time.Minute
+
+// unknown key ids trigger an early refetch, but not more often than this
+const minJWKSRefetchInterval = 30 * time.Second
+
+const jwksFetchTimeout = 5 * time.Second
+
+// After a failed fetch the next one waits jwksRetryBackoff, doubling with
+// every failure in a row up to maxJWKSRetryBackoff
+const (
+	jwksRetryBackoff    = time.Second
+	maxJWKSRetryBackoff = 5 * time.Minute
+)
+
+// KeySetSource is where a JWKSVerifier gets its keys from
+type KeySetSource interface {
+	KeySet(ctx context.Context) (JWKS, error)
+}
+
+// URLKeySet fetches a key set over HTTP, usually from /.well-known/jwks.json
+type URLKeySet struct {
+	URL    string
+	Client *http.Client
+}
+
+// KeySet implements KeySetSource
+func (src URLKeySet) KeySet(ctx context.Context) (JWKS, error) {
+	client := src.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, src.URL, nil)
+	if err != nil {
+		return JWKS{}, err
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return JWKS{}, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return JWKS{}, fmt.Errorf("failed to fetch key set: %s", res.Status)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return JWKS{}, fmt.Errorf("failed to decode key set: %w", err)
+	}
+	return set, nil
+}
+
+// FileKeySet reads a key set from a local JSON file.
+// It is meant as a stand-in for URLKeySet in tests and offline setups.
+type FileKeySet struct {
+	Path string
+}
+
+// KeySet implements KeySetSource
+func (src FileKeySet) KeySet(ctx context.Context) (JWKS, error) {
+	data, err := ioutil.ReadFile(src.Path)
+	if err != nil {
+		return JWKS{}, fmt.Errorf("failed to read key set: %w", err)
+	}
+
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return JWKS{}, fmt.Errorf("failed to decode key set: %w", err)
+	}
+	return set, nil
+}
+
+// JWKSVerifier verifies asymmetrically signed JWTs with keys from a JWKS.
+// Keys are cached and refetched periodically, or early when a token names a
+// key id that has not been seen yet (which is what happens after a rotation).
+type JWKSVerifier struct {
+	source          KeySetSource
+	refreshInterval time.Duration
+	claims          claimsConfig
+
+	// fetches merges concurrent refreshes into one request
+	fetches singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]VerificationKey
+	fetchedAt time.Time
+	// failures counts the fetches that failed in a row, no fetch is made
+	// before retryAt
+	failures int
+	retryAt  time.Time
+}
+
+// NewJWKSVerifier ...
+func NewJWKSVerifier(source KeySetSource, refreshInterval time.Duration, opts ...Option) *JWKSVerifier {
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultJWKSRefreshInterval
+	}
+
+	return &JWKSVerifier{
+		source:          source,
+		refreshInterval: refreshInterval,
+		claims:          newClaimsConfig(opts),
+		keys:            make(map[string]VerificationKey),
+	}
+}
+
+// VerifyToken implements Verifier
+func (v *JWKSVerifier) VerifyToken(token string) (*Payload, error) {
+	return parseJWT(token, keyLookupFunc(v.lookup), v.claims)
+}
+
+// Refresh fetches the key set right away. Callers that come in while a
+// fetch is running share its result.
+func (v *JWKSVerifier) Refresh(ctx context.Context) error {
+	_, err, _ := v.fetches.Do("", func() (interface{}, error) {
+		return nil, v.fetch(ctx)
+	})
+	return err
+}
+
+func (v *JWKSVerifier) fetch(ctx context.Context) error {
+	set, err := v.source.KeySet(ctx)
+	if err != nil {
+		v.mu.Lock()
+		backoff := jwksRetryBackoff << v.failures
+		if backoff <= 0 || backoff > maxJWKSRetryBackoff {
+			backoff = maxJWKSRetryBackoff
+		}
+		v.failures++
+		v.retryAt = time.Now().Add(backoff)
+		v.mu.Unlock()
+		return err
+	}
+
+	keys := make(map[string]VerificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.VerificationKey()
+		if err != nil {
+			l.W("skipping key", jwk.KeyID, err)
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.failures = 0
+	v.retryAt = time.Time{}
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *JWKSVerifier) lookup(kid string) (VerificationKey, bool) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	age := time.Since(v.fetchedAt)
+	backingOff := time.Now().Before(v.retryAt)
+	v.mu.RUnlock()
+
+	stale := age > v.refreshInterval
+	if ok && !stale {
+		return key, true
+	}
+	if !ok && !stale && age < minJWKSRefetchInterval {
+		return VerificationKey{}, false
+	}
+	// The key server failed a moment ago, don't pile more requests on it
+	if backingOff {
+		return key, ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	if err := v.Refresh(ctx); err != nil {
+		// Keep using what we have, a key server hiccup should not fail every request
+		l.E(err)
+		return key, ok
+	}
+
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+	return key, ok
+}
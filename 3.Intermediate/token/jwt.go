@@ -10,46 +10,89 @@ import (
 
 const minSecretKeySize = 32
 
-// JWTToken ...
+// JWTToken signs tokens either with a shared HMAC secret or, when it has a
+// key ring, with an asymmetric key that is named in the "kid" header
 type JWTToken struct {
 	secretKey string
+	keys      *KeyRing
+	claims    claimsConfig
 }
 
 // NewJWTToken ...
-func NewJWTToken(secretKey string) (Tokener, error) {
+func NewJWTToken(secretKey string, opts ...Option) (Tokener, error) {
 	if len(secretKey) < minSecretKeySize {
 		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
 	}
-	return &JWTToken{secretKey}, nil
+	return &JWTToken{secretKey: secretKey, claims: newClaimsConfig(opts)}, nil
+}
+
+// NewJWTKeyRingToken creates a JWTToken that signs with RS256, ES256 or EdDSA
+// depending on the type of the key ring's signing key
+func NewJWTKeyRingToken(keys *KeyRing, opts ...Option) (Tokener, error) {
+	if keys == nil {
+		return nil, errors.New("key ring is required")
+	}
+	return &JWTToken{keys: keys, claims: newClaimsConfig(opts)}, nil
 }
 
 // CreateToken implements the interface
-func (maker *JWTToken) CreateToken(username string, duration time.Duration) (string, error) {
-	payload, err := NewPayload(username, duration)
+func (maker *JWTToken) CreateToken(identity Identity, duration time.Duration) (string, error) {
+	payload, err := maker.claims.newPayload(identity, duration)
 	if err != nil {
 		return "", err
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	return jwtToken.SignedString([]byte(maker.secretKey))
+	if maker.keys == nil {
+		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+		return jwtToken.SignedString([]byte(maker.secretKey))
+	}
+
+	signing := maker.keys.SigningKey()
+	jwtToken := jwt.NewWithClaims(signing.Method, payload)
+	jwtToken.Header["kid"] = signing.ID
+	return jwtToken.SignedString(signing.Key)
 }
 
 // VerifyToken implements the interface
 func (maker *JWTToken) VerifyToken(token string) (*Payload, error) {
-	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	if maker.keys == nil {
+		return parseJWT(token, maker.hmacKeyFunc, maker.claims)
+	}
+	return parseJWT(token, keyLookupFunc(maker.keys.VerificationKey), maker.claims)
+}
+
+func (maker *JWTToken) hmacKeyFunc(token *jwt.Token) (interface{}, error) {
+	_, ok := token.Method.(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return []byte(maker.secretKey), nil
+}
+
+// keyLookupFunc picks the verification key named by the "kid" header
+func keyLookupFunc(lookup func(kid string) (VerificationKey, bool)) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := lookup(kid)
 		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(maker.secretKey), nil
+
+		// Never let the token pick the algorithm, it has to match the key
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.Key, nil
 	}
+}
 
-	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+// parseJWT checks the signature with keyFunc and the claims with our own
+// claimsConfig instead of Payload.Valid, so issuer, audience and clock apply
+func parseJWT(token string, keyFunc jwt.Keyfunc, claims claimsConfig) (*Payload, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	jwtToken, err := parser.ParseWithClaims(token, &Payload{}, keyFunc)
 	if err != nil {
-		verr, ok := err.(*jwt.ValidationError)
-		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
-			return nil, ErrExpiredToken
-		}
 		return nil, ErrInvalidToken
 	}
 
@@ -58,5 +101,10 @@ func (maker *JWTToken) VerifyToken(token string) (*Payload, error) {
 		return nil, ErrInvalidToken
 	}
 
+	err = claims.validate(payload)
+	if err != nil {
+		return nil, err
+	}
+
 	return payload, nil
 }
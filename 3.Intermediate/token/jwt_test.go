@@ -0,0 +1,194 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func newTestKeyRing(t *testing.T, id string, key crypto.Signer, old ...VerificationKey) *KeyRing {
+	t.Helper()
+	method, err := signingMethodFor(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := NewKeyRing(SigningKey{ID: id, Method: method, Key: key}, old...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestJWTHMACRoundTrip(t *testing.T) {
+	maker, err := NewJWTToken(testSymmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := maker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := maker.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Username != "alice" || !payload.HasRole("admin") {
+		t.Errorf("got %+v", payload)
+	}
+
+	// A verifier that only knows the registered claims must see the expiry
+	var standard jwt.StandardClaims
+	_, err = jwt.ParseWithClaims(token, &standard, func(*jwt.Token) (interface{}, error) {
+		return []byte(testSymmetricKey), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standard.ExpiresAt != payload.ExpiredAt.Unix() || standard.IssuedAt != payload.IssuedAt.Unix() {
+		t.Errorf("standard claims exp %d, iat %d", standard.ExpiresAt, standard.IssuedAt)
+	}
+
+	other, err := NewJWTToken(testSymmetricKey + "-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.VerifyToken(token); err != ErrInvalidToken {
+		t.Errorf("other secret: got %v, want ErrInvalidToken", err)
+	}
+
+	if _, err := NewJWTToken("short"); err == nil {
+		t.Error("short secret accepted")
+	}
+}
+
+func TestJWTKeyRingRotation(t *testing.T) {
+	oldKey, newKey := newECKey(t), newRSAKey(t)
+
+	oldRing := newTestKeyRing(t, "2021-01", oldKey)
+	oldMaker, err := NewJWTKeyRingToken(oldRing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := oldMaker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the rotation the old public key is only used for verifying
+	oldPublic, _ := oldRing.VerificationKey("2021-01")
+	newRing := newTestKeyRing(t, "2021-02", newKey, oldPublic)
+	newMaker, err := NewJWTKeyRingToken(newRing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := newMaker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tt := range map[string]struct {
+		token string
+		kid   string
+		alg   string
+	}{
+		"old": {oldToken, "2021-01", "ES256"},
+		"new": {newToken, "2021-02", "RS256"},
+	} {
+		parsed, _, err := new(jwt.Parser).ParseUnverified(tt.token, &Payload{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header["kid"] != tt.kid || parsed.Method.Alg() != tt.alg {
+			t.Errorf("%s token has kid %v and alg %s", name, parsed.Header["kid"], parsed.Method.Alg())
+		}
+		if _, err := newMaker.VerifyToken(tt.token); err != nil {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+
+	// The old ring never heard of the new key
+	if _, err := oldMaker.VerifyToken(newToken); err != ErrInvalidToken {
+		t.Errorf("unknown kid: got %v, want ErrInvalidToken", err)
+	}
+}
+
+// A token must not be able to choose how it is checked. Signing HS256 with
+// the public key as the secret is the classic attack on RS256 verifiers.
+func TestJWTAlgorithmPinning(t *testing.T) {
+	key := newRSAKey(t)
+	ring := newTestKeyRing(t, "rsa", key)
+	maker, err := NewJWTKeyRingToken(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	payload, err := NewPayload(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, payload)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := map[string]string{
+		"HS256 with public key PEM": sign(jwt.SigningMethodHS256, "rsa", publicPEM),
+		"HS256 with public key DER": sign(jwt.SigningMethodHS256, "rsa", der),
+		"none":                      sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType),
+		"ES256 under an RSA kid":    sign(jwt.SigningMethodES256, "rsa", newECKey(t)),
+		"RS256 with another key":    sign(jwt.SigningMethodRS256, "rsa", newRSAKey(t)),
+	}
+	for name, token := range tests {
+		if _, err := maker.VerifyToken(token); err != ErrInvalidToken {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	// And the HMAC tokener refuses asymmetric tokens
+	hmac, err := NewJWTToken(testSymmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hmac.VerifyToken(sign(jwt.SigningMethodRS256, "rsa", key)); err != ErrInvalidToken {
+		t.Errorf("RS256 on the HMAC tokener: got %v, want ErrInvalidToken", err)
+	}
+}
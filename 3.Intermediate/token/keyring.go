@@ -0,0 +1,195 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey is the private key new tokens are signed with
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// VerificationKey is a public key that tokens are still accepted from
+type VerificationKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.PublicKey
+}
+
+// KeyRing holds one signing key and every verification key that is active.
+// Keeping the previous public keys around lets tokens signed before a
+// rotation stay valid until they expire.
+type KeyRing struct {
+	signing SigningKey
+	verify  map[string]VerificationKey
+}
+
+// NewKeyRing builds a key ring. The public half of the signing key is
+// always part of the verification set.
+func NewKeyRing(signing SigningKey, verification ...VerificationKey) (*KeyRing, error) {
+	if signing.ID == "" {
+		return nil, errors.New("signing key must have an id")
+	}
+
+	ring := &KeyRing{
+		signing: signing,
+		verify:  make(map[string]VerificationKey),
+	}
+
+	current := VerificationKey{ID: signing.ID, Method: signing.Method, Key: signing.Key.Public()}
+	for _, key := range append([]VerificationKey{current}, verification...) {
+		if _, ok := ring.verify[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ring.verify[key.ID] = key
+	}
+
+	return ring, nil
+}
+
+// LoadKeyRing reads a PEM encoded private key to sign with and any number of
+// PEM encoded keys to verify with. The file name without its extension is used
+// as the key id, so "2021-03.pem" is published as kid "2021-03".
+func LoadKeyRing(signingKeyFile string, verificationKeyFiles ...string) (*KeyRing, error) {
+	block, err := readPEM(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", signingKeyFile, err)
+	}
+
+	method, err := signingMethodFor(privateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", signingKeyFile, err)
+	}
+
+	signing := SigningKey{ID: keyID(signingKeyFile), Method: method, Key: privateKey}
+
+	var verification []VerificationKey
+	for _, file := range verificationKeyFiles {
+		block, err := readPEM(file)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, err := parsePublicKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		method, err := signingMethodFor(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		verification = append(verification, VerificationKey{ID: keyID(file), Method: method, Key: publicKey})
+	}
+
+	return NewKeyRing(signing, verification...)
+}
+
+// SigningKey returns the key new tokens are signed with
+func (ring *KeyRing) SigningKey() SigningKey {
+	return ring.signing
+}
+
+// VerificationKey looks up an active verification key by its id
+func (ring *KeyRing) VerificationKey(id string) (VerificationKey, bool) {
+	key, ok := ring.verify[id]
+	return key, ok
+}
+
+func keyID(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", file)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// parsePublicKey also accepts private keys, so the old signing key file can
+// simply be listed as a verification key after a rotation
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		signer, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+}
+
+func signingMethodFor(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return SigningMethodEd25519, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
@@ -0,0 +1,64 @@
+package token
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	dir := t.TempDir()
+
+	signing, err := x509.MarshalPKCS8PrivateKey(newECKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublic, err := x509.MarshalPKIXPublicKey(newRSAKey(t).Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	olderPrivate := x509.MarshalPKCS1PrivateKey(newRSAKey(t))
+
+	ring, err := LoadKeyRing(
+		writePEM(t, dir, "2021-03.pem", "PRIVATE KEY", signing),
+		writePEM(t, dir, "2021-02.pem", "PUBLIC KEY", oldPublic),
+		// a retired signing key file works as a verification key
+		writePEM(t, dir, "2021-01.key", "RSA PRIVATE KEY", olderPrivate),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key := ring.SigningKey(); key.ID != "2021-03" || key.Method != jwt.SigningMethodES256 {
+		t.Errorf("signing key %s %s", key.ID, key.Method.Alg())
+	}
+	for id, alg := range map[string]string{"2021-03": "ES256", "2021-02": "RS256", "2021-01": "RS256"} {
+		key, ok := ring.VerificationKey(id)
+		if !ok || key.Method.Alg() != alg {
+			t.Errorf("verification key %s: %v %+v", id, ok, key)
+		}
+	}
+	if _, ok := ring.VerificationKey("2020-12"); ok {
+		t.Error("found a key that was never loaded")
+	}
+
+	if _, err := LoadKeyRing(filepath.Join(dir, "2021-02.pem")); err == nil {
+		t.Error("a public key was accepted as the signing key")
+	}
+	if _, err := LoadKeyRing(filepath.Join(dir, "2021-03.pem"), filepath.Join(dir, "2021-03.pem")); err == nil {
+		t.Error("duplicate key ids were accepted")
+	}
+}
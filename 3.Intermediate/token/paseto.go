@@ -0,0 +1,57 @@
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aead/chacha20poly1305"
+	"github.com/o1egl/paseto"
+)
+
+// PasetoToken creates symmetric (v2.local) PASETO tokens
+type PasetoToken struct {
+	paseto       *paseto.V2
+	symmetricKey []byte
+	claims       claimsConfig
+}
+
+// NewPasetoToken ...
+func NewPasetoToken(symmetricKey string, opts ...Option) (Tokener, error) {
+	if len(symmetricKey) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("invalid key size: must be exactly %d characters", chacha20poly1305.KeySize)
+	}
+
+	maker := &PasetoToken{
+		paseto:       paseto.NewV2(),
+		symmetricKey: []byte(symmetricKey),
+		claims:       newClaimsConfig(opts),
+	}
+	return maker, nil
+}
+
+// CreateToken implements the interface
+func (maker *PasetoToken) CreateToken(identity Identity, duration time.Duration) (string, error) {
+	payload, err := maker.claims.newPayload(identity, duration)
+	if err != nil {
+		return "", err
+	}
+
+	return maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+}
+
+// VerifyToken implements the interface
+func (maker *PasetoToken) VerifyToken(token string) (*Payload, error) {
+	payload := &Payload{}
+
+	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = maker.claims.validate(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
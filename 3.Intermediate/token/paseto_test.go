@@ -0,0 +1,104 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSymmetricKey = "tR8cVn2LqW5xZ0pK7sD4fG1hJ9mB3yUe"
+
+var testIdentity = Identity{Username: "alice", Roles: []string{"admin"}, Scopes: []string{"users:read"}}
+
+func TestPasetoRoundTrip(t *testing.T) {
+	maker, err := NewPasetoToken(testSymmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := maker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "v2.local.") {
+		t.Errorf("not a v2.local token: %s", token)
+	}
+
+	payload, err := maker.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Username != "alice" || !payload.HasRole("admin") || !payload.HasScope("users:read") {
+		t.Errorf("got %+v", payload)
+	}
+	if d := payload.ExpiredAt.Sub(payload.IssuedAt.Time); d != time.Minute {
+		t.Errorf("token lives %v, want 1m", d)
+	}
+}
+
+func TestPasetoExpired(t *testing.T) {
+	now := time.Now()
+	issuer, err := NewPasetoToken(testSymmetricKey, WithClock(func() time.Time { return now.Add(-time.Hour) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := issuer.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maker, err := NewPasetoToken(testSymmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := maker.VerifyToken(token); err != ErrExpiredToken {
+		t.Errorf("got %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestPasetoTampered(t *testing.T) {
+	maker, err := NewPasetoToken(testSymmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := maker.CreateToken(testIdentity, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip one character of the encrypted body
+	i := len(token) - 10
+	c := byte('A')
+	if token[i] == c {
+		c = 'B'
+	}
+	tampered := token[:i] + string(c) + token[i+1:]
+
+	other, err := NewPasetoToken(strings.ToUpper(testSymmetricKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		maker Tokener
+		token string
+	}{
+		"tampered":  {maker, tampered},
+		"other key": {other, token},
+		"garbage":   {maker, "v2.local.garbage"},
+		"empty":     {maker, ""},
+	}
+	for name, tt := range tests {
+		if _, err := tt.maker.VerifyToken(tt.token); err != ErrInvalidToken {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestPasetoKeySize(t *testing.T) {
+	for _, key := range []string{"", "short", testSymmetricKey + "x"} {
+		if _, err := NewPasetoToken(key); err == nil {
+			t.Errorf("key of %d bytes accepted", len(key))
+		}
+	}
+}
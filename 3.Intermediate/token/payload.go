@@ -13,16 +13,34 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// Identity is who a token is issued for and what they are allowed to do
+type Identity struct {
+	Username string
+	Roles    []string
+	Scopes   []string
+}
+
 // Payload is the claim response
 type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiredAt time.Time `json:"expired_at"`
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Roles    []string  `json:"roles,omitempty"`
+	Scopes   []string  `json:"scopes,omitempty"`
+	// Registered claims, see RFC 7519 section 4.1
+	IssuedAt  NumericDate `json:"iat"`
+	ExpiredAt NumericDate `json:"exp"`
+	Issuer    string      `json:"iss,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	Subject   string      `json:"sub"`
+	NotBefore NumericDate `json:"nbf"`
 }
 
 // NewPayload ...
-func NewPayload(username string, duration time.Duration) (*Payload, error) {
+func NewPayload(identity Identity, duration time.Duration) (*Payload, error) {
+	return newPayload(identity, duration, time.Now())
+}
+
+func newPayload(identity Identity, duration time.Duration, now time.Time) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -30,17 +48,38 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 
 	payload := &Payload{
 		ID:        tokenID,
-		Username:  username,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
+		Username:  identity.Username,
+		Roles:     identity.Roles,
+		Scopes:    identity.Scopes,
+		IssuedAt:  NumericDate{now},
+		ExpiredAt: NumericDate{now.Add(duration)},
+		Subject:   identity.Username,
+		NotBefore: NumericDate{now},
 	}
 	return payload, nil
 }
 
-// Valid checks to see whether the token payload is valid or not
-func (payload *Payload) Valid() error {
-	if time.Now().After(payload.ExpiredAt) {
-		return ErrExpiredToken
+// HasRole ...
+func (payload *Payload) HasRole(role string) bool {
+	return contains(payload.Roles, role)
+}
+
+// HasScope ...
+func (payload *Payload) HasScope(scope string) bool {
+	return contains(payload.Scopes, scope)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
-	return nil
+	return false
+}
+
+// Valid checks to see whether the token payload is valid or not.
+// It looks at the timestamps and sub, tokeners check iss and aud on top of that.
+func (payload *Payload) Valid() error {
+	return newClaimsConfig(nil).validate(payload)
 }
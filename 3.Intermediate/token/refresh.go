@@ -0,0 +1,28 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const refreshTokenSize = 32
+
+// NewRefreshToken generates an opaque refresh token.
+// Only the returned hash should be persisted, the token itself goes to the client.
+func NewRefreshToken() (token string, hash string, err error) {
+	b := make([]byte, refreshTokenSize)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the value under which a refresh token is stored
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
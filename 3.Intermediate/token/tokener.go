@@ -1,12 +1,54 @@
 package token
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/util"
+)
+
+// Supported token backends
+const (
+	TypeJWT    = "jwt"
+	TypePaseto = "paseto"
 )
 
 // Tokener ...
 type Tokener interface {
-	CreateToken(username string, duration time.Duration) (string, error)
+	CreateToken(identity Identity, duration time.Duration) (string, error)
+
+	Verifier
+}
 
+// Verifier is the read only half of a Tokener, for services that accept
+// our tokens but never issue them
+type Verifier interface {
 	VerifyToken(token string) (*Payload, error)
 }
+
+// NewTokener creates the Tokener selected by TOKEN_TYPE. An empty type falls
+// back to JWT, which signs asymmetrically when TOKEN_SIGNING_KEY_FILE is set.
+func NewTokener(config util.Config) (Tokener, error) {
+	opts := []Option{
+		WithIssuer(config.TokenIssuer),
+		WithAudience(config.TokenAudience),
+		WithLeeway(config.TokenClockSkew),
+	}
+
+	switch config.TokenType {
+	case "", TypeJWT:
+		if config.TokenSigningKeyFile == "" {
+			return NewJWTToken(config.TokenSymmetricKey, opts...)
+		}
+
+		keys, err := LoadKeyRing(config.TokenSigningKeyFile, config.TokenVerificationKeyFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key ring: %w", err)
+		}
+		return NewJWTKeyRingToken(keys, opts...)
+	case TypePaseto:
+		return NewPasetoToken(config.TokenSymmetricKey, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported token type %q", config.TokenType)
+	}
+}
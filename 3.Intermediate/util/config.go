@@ -1,28 +1,74 @@
 package util
 
-import (
-	"github.com/spf13/viper"
-)
+import "time"
 
 // Config ...
 type Config struct {
-	DBSource      string `mapstructure:"DB_SOURCE"`
+	// DBDriver is "postgres", "sqlite" or "memory", see db.NewStore.
+	// For sqlite DBSource is the database file, e.g. "file:myapp.db".
+	DBDriver string `mapstructure:"DB_DRIVER"`
+	DBSource string `mapstructure:"DB_SOURCE" secret:"dsn"`
+	// Connection pool, zero values keep the pgxpool defaults
+	DBMaxConns          int32         `mapstructure:"DB_MAX_CONNS"`
+	DBMinConns          int32         `mapstructure:"DB_MIN_CONNS"`
+	DBMaxConnLifetime   time.Duration `mapstructure:"DB_MAX_CONN_LIFETIME"`
+	DBMaxConnIdleTime   time.Duration `mapstructure:"DB_MAX_CONN_IDLE_TIME"`
+	DBHealthCheckPeriod time.Duration `mapstructure:"DB_HEALTH_CHECK_PERIOD"`
+	// DBRequestTimeout bounds the database work of a single HTTP request
+	DBRequestTimeout time.Duration `mapstructure:"DB_REQUEST_TIMEOUT"`
+
 	ServerAddress string `mapstructure:"SERVER_ADDRESS"`
-}
+	// Timeouts of the HTTP server, 0 means none. See net/http.Server.
+	HTTPReadTimeout  time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`
+	HTTPWriteTimeout time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT"`
+	HTTPIdleTimeout  time.Duration `mapstructure:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long requests in flight get to finish after
+	// SIGINT or SIGTERM
+	ShutdownTimeout time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	// The server speaks HTTPS when both are set
+	TLSCertFile string `mapstructure:"TLS_CERT_FILE"`
+	TLSKeyFile  string `mapstructure:"TLS_KEY_FILE"`
 
-// LoadConfig ...
-func LoadConfig(path string) (config Config, err error) {
-	viper.AddConfigPath(path)
-	viper.SetConfigName("myapp")
-	viper.SetConfigType("env")
+	TokenType         string `mapstructure:"TOKEN_TYPE"`
+	TokenSymmetricKey string `mapstructure:"TOKEN_SYMMETRIC_KEY" secret:"true"`
+	// How long access tokens and refresh tokens (sessions) are valid
+	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	// PEM file names; the file name without extension becomes the key id.
+	// TokenVerificationKeyFiles is a comma separated list of older keys that
+	// are still accepted during a rotation.
+	TokenSigningKeyFile       string   `mapstructure:"TOKEN_SIGNING_KEY_FILE"`
+	TokenVerificationKeyFiles []string `mapstructure:"TOKEN_VERIFICATION_KEY_FILES"`
+	// Tokens carry the issuer and audience, and tokens with other values are
+	// refused. Both are required.
+	TokenIssuer    string        `mapstructure:"TOKEN_ISSUER"`
+	TokenAudience  string        `mapstructure:"TOKEN_AUDIENCE"`
+	TokenClockSkew time.Duration `mapstructure:"TOKEN_CLOCK_SKEW"`
+	// RevocationStore is "store" to keep revoked token ids next to the users
+	// or "memory" for a single instance that can forget them on restart
+	RevocationStore         string        `mapstructure:"REVOCATION_STORE"`
+	RevocationPruneInterval time.Duration `mapstructure:"REVOCATION_PRUNE_INTERVAL"`
 
-	viper.AutomaticEnv()
+	// LogLevel is trace, debug, info, warn or error
+	LogLevel string `mapstructure:"LOG_LEVEL"`
+	// RateLimit is the number of requests per second allowed from one
+	// client IP, with bursts of up to RateLimitBurst. 0 turns it off.
+	RateLimit      float64 `mapstructure:"RATE_LIMIT"`
+	RateLimitBurst int     `mapstructure:"RATE_LIMIT_BURST"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header is believed. Other clients are known by
+	// the address they connect from.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
 
-	err = viper.ReadInConfig()
+	// sources records the layer each setting came from, see ConfigLoader
+	sources map[string]ConfigSource
+}
+
+// LoadConfig loads the config without command line flags, see ConfigLoader
+func LoadConfig(path string) (config Config, err error) {
+	loader, err := NewConfigLoader(path, nil)
 	if err != nil {
-		return
+		return Config{}, err
 	}
-
-	err = viper.Unmarshal(&config)
-	return
+	return loader.Load()
 }
@@ -0,0 +1,281 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// defaults are the bottom layer of the config, keys missing here default
+// to the zero value
+var defaults = map[string]interface{}{
+	"DB_DRIVER":                 "postgres",
+	"SERVER_ADDRESS":            "0.0.0.0:5555",
+	"HTTP_READ_TIMEOUT":         10 * time.Second,
+	"HTTP_WRITE_TIMEOUT":        30 * time.Second,
+	"HTTP_IDLE_TIMEOUT":         2 * time.Minute,
+	"SHUTDOWN_TIMEOUT":          15 * time.Second,
+	"TOKEN_TYPE":                "jwt",
+	"ACCESS_TOKEN_DURATION":     time.Hour,
+	"REFRESH_TOKEN_DURATION":    24 * time.Hour,
+	"TOKEN_CLOCK_SKEW":          30 * time.Second,
+	"REVOCATION_STORE":          "store",
+	"REVOCATION_PRUNE_INTERVAL": 10 * time.Minute,
+	"LOG_LEVEL":                 "trace",
+}
+
+const (
+	// defaultConfigFile is read from the config directory when it exists
+	defaultConfigFile = "myapp.env"
+	// configFileEnv and --config name a config file that must exist
+	configFileEnv  = "CONFIG_FILE"
+	configFileFlag = "config"
+	// secretFileSuffix reads KEY from the file named by KEY_FILE,
+	// the way Docker and Kubernetes hand out secrets
+	secretFileSuffix = "_FILE"
+)
+
+// ConfigSource is the layer a setting came from
+type ConfigSource string
+
+// Config sources, from the bottom layer to the top
+const (
+	SourceDefault ConfigSource = "default"
+	SourceFile    ConfigSource = "file"
+	SourceEnv     ConfigSource = "env"
+	// SourceEnvFile is a KEY_FILE secret file
+	SourceEnvFile ConfigSource = "env-file"
+	SourceFlag    ConfigSource = "flag"
+)
+
+// configKey is one setting of Config
+type configKey struct {
+	// name is the mapstructure tag, which is also the environment variable
+	name string
+	flag string
+	typ  reflect.Type
+	// index is the field index in Config
+	index int
+	// secret is the secret tag, see Config.Values
+	secret string
+}
+
+// configKeys lists every setting of Config, in field order
+func configKeys() []configKey {
+	t := reflect.TypeOf(Config{})
+	keys := make([]configKey, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("mapstructure")
+		if name == "" {
+			continue
+		}
+		keys = append(keys, configKey{
+			name:   name,
+			flag:   strings.ReplaceAll(strings.ToLower(name), "_", "-"),
+			typ:    t.Field(i).Type,
+			index:  i,
+			secret: t.Field(i).Tag.Get("secret"),
+		})
+	}
+	return keys
+}
+
+// ConfigLoader builds a Config from layers, each one overriding the one
+// before it:
+//
+//  1. the built-in defaults
+//  2. a config file, myapp.env in the config directory or the one named by
+//     --config or CONFIG_FILE; env, yaml, toml and json files all work
+//  3. environment variables, or for KEY the contents of the file in KEY_FILE
+//  4. command line flags, --db-source for DB_SOURCE and so on
+//
+// Every ConfigLoader has a viper instance of its own.
+type ConfigLoader struct {
+	dir   string
+	keys  []configKey
+	flags *pflag.FlagSet
+	// lookupEnv is os.LookupEnv, tests replace it
+	lookupEnv func(key string) (string, bool)
+}
+
+// NewConfigLoader parses the flags in args. dir is where myapp.env is
+// looked for. A -h or --help in args returns pflag.ErrHelp.
+func NewConfigLoader(dir string, args []string) (*ConfigLoader, error) {
+	l := &ConfigLoader{
+		dir:       dir,
+		keys:      configKeys(),
+		flags:     pflag.NewFlagSet(filepath.Base(os.Args[0]), pflag.ContinueOnError),
+		lookupEnv: os.LookupEnv,
+	}
+
+	l.flags.SortFlags = false
+	l.flags.String(configFileFlag, "", "config file (env, yaml, toml or json), overrides "+configFileEnv)
+	for _, k := range l.keys {
+		usage := "overrides " + k.name
+		switch k.typ {
+		case reflect.TypeOf(time.Duration(0)):
+			l.flags.Duration(k.flag, 0, usage)
+		case reflect.TypeOf([]string{}):
+			l.flags.StringSlice(k.flag, nil, usage)
+		default:
+			switch k.typ.Kind() {
+			case reflect.Int32:
+				l.flags.Int32(k.flag, 0, usage)
+			case reflect.Int:
+				l.flags.Int(k.flag, 0, usage)
+			case reflect.Float64:
+				l.flags.Float64(k.flag, 0, usage)
+			case reflect.Bool:
+				l.flags.Bool(k.flag, false, usage)
+			default:
+				l.flags.String(k.flag, "", usage)
+			}
+		}
+	}
+
+	if err := l.flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Args returns the arguments left after the flags, i.e. the subcommand
+func (l *ConfigLoader) Args() []string {
+	return l.flags.Args()
+}
+
+// Usage describes the flags
+func (l *ConfigLoader) Usage() string {
+	return l.flags.FlagUsages()
+}
+
+// ConfigFile returns the config file Load reads, or "" when there is none
+func (l *ConfigLoader) ConfigFile() (string, error) {
+	if f := l.flags.Lookup(configFileFlag); f.Changed {
+		return f.Value.String(), nil
+	}
+	if file, ok := l.lookupEnv(configFileEnv); ok && file != "" {
+		return file, nil
+	}
+
+	file := filepath.Join(l.dir, defaultConfigFile)
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return file, nil
+}
+
+// Load reads every layer and returns the result. It can be called again
+// to pick up a changed config file.
+func (l *ConfigLoader) Load() (Config, error) {
+	v := viper.New()
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	sources := make(map[string]ConfigSource, len(l.keys))
+	for _, k := range l.keys {
+		sources[k.name] = SourceDefault
+	}
+
+	file, err := l.ConfigFile()
+	if err != nil {
+		return Config{}, err
+	}
+	if file != "" {
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return Config{}, fmt.Errorf("config file %s: %w", file, err)
+		}
+		for _, k := range l.keys {
+			// viper keeps the keys of the file in lower case
+			if v.InConfig(strings.ToLower(k.name)) {
+				sources[k.name] = SourceFile
+			}
+		}
+	}
+
+	// Set is the top layer of viper, so the environment and then the
+	// flags are applied in order of precedence
+	for _, k := range l.keys {
+		value, source, err := l.env(k.name)
+		if err != nil {
+			return Config{}, err
+		}
+		if source != "" {
+			v.Set(k.name, value)
+			sources[k.name] = source
+		}
+	}
+	for _, k := range l.keys {
+		if l.flags.Changed(k.flag) {
+			v.Set(k.name, l.flagValue(k))
+			sources[k.name] = SourceFlag
+		}
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return Config{}, err
+	}
+	config.sources = sources
+	return config, nil
+}
+
+// env returns the value of key from the environment, or from the file
+// named by key_FILE. Empty variables count as unset, the source is ""
+// when key is not set.
+func (l *ConfigLoader) env(key string) (string, ConfigSource, error) {
+	value, ok := l.lookupEnv(key)
+	ok = ok && value != ""
+
+	file, fileOK := l.lookupEnv(key + secretFileSuffix)
+	if !fileOK || file == "" {
+		if !ok {
+			return "", "", nil
+		}
+		return value, SourceEnv, nil
+	}
+	if ok {
+		return "", "", fmt.Errorf("both %s and %s%s are set, use one of them", key, key, secretFileSuffix)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", fmt.Errorf("%s%s: %w", key, secretFileSuffix, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), SourceEnvFile, nil
+}
+
+func (l *ConfigLoader) flagValue(k configKey) interface{} {
+	var value interface{}
+	switch k.typ {
+	case reflect.TypeOf(time.Duration(0)):
+		value, _ = l.flags.GetDuration(k.flag)
+	case reflect.TypeOf([]string{}):
+		value, _ = l.flags.GetStringSlice(k.flag)
+	default:
+		switch k.typ.Kind() {
+		case reflect.Int32:
+			value, _ = l.flags.GetInt32(k.flag)
+		case reflect.Int:
+			value, _ = l.flags.GetInt(k.flag)
+		case reflect.Float64:
+			value, _ = l.flags.GetFloat64(k.flag)
+		case reflect.Bool:
+			value, _ = l.flags.GetBool(k.flag)
+		default:
+			value = l.flags.Lookup(k.flag).Value.String()
+		}
+	}
+	return value
+}
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLoader writes files to a fresh config directory. $DIR in env and
+// args stands for that directory.
+func newTestLoader(t *testing.T, files map[string]string, env map[string]string, args ...string) *ConfigLoader {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range args {
+		args[i] = strings.ReplaceAll(args[i], "$DIR", dir)
+	}
+
+	l, err := NewConfigLoader(dir, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.lookupEnv = func(key string) (string, bool) {
+		value, ok := env[strings.ReplaceAll(key, "$DIR", dir)]
+		return strings.ReplaceAll(value, "$DIR", dir), ok
+	}
+	return l
+}
+
+func TestConfigLoaderLayers(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"myapp.env": "SERVER_ADDRESS=file:1\nDB_SOURCE=file-source\nDB_MAX_CONNS=5\nTOKEN_ISSUER=file-issuer\n",
+	}
+	env := map[string]string{
+		"DB_SOURCE":    "env-source",
+		"TOKEN_ISSUER": "env-issuer",
+		// empty variables do not hide the file
+		"DB_MAX_CONNS": "",
+	}
+	l := newTestLoader(t, files, env, "--token-issuer", "flag-issuer", "--access-token-duration", "5m", "migrate", "up")
+
+	config, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"default":      config.RefreshTokenDuration == 24*time.Hour,
+		"file":         config.ServerAddress == "file:1" && config.DBMaxConns == 5,
+		"env":          config.DBSource == "env-source",
+		"flag":         config.TokenIssuer == "flag-issuer",
+		"typed flag":   config.AccessTokenDuration == 5*time.Minute,
+		"args":         reflect.DeepEqual(l.Args(), []string{"migrate", "up"}),
+		"zero default": config.TokenAudience == "",
+	}
+	for layer, ok := range want {
+		if !ok {
+			t.Errorf("%s layer not applied: %+v", layer, config)
+		}
+	}
+}
+
+func TestConfigLoaderFileFormats(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"app.yaml": "server_address: yaml:1\ntoken_verification_key_files:\n  - a.pem\n  - b.pem\n",
+		"app.toml": "SERVER_ADDRESS = \"toml:1\"\nDB_REQUEST_TIMEOUT = \"3s\"\n",
+	}
+
+	l := newTestLoader(t, files, map[string]string{"CONFIG_FILE": "$DIR/app.yaml"})
+	config, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerAddress != "yaml:1" || !reflect.DeepEqual(config.TokenVerificationKeyFiles, []string{"a.pem", "b.pem"}) {
+		t.Errorf("yaml not loaded: %+v", config)
+	}
+
+	l = newTestLoader(t, files, map[string]string{"CONFIG_FILE": "$DIR/app.yaml"}, "--config", "$DIR/app.toml")
+	config, err = l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerAddress != "toml:1" || config.DBRequestTimeout != 3*time.Second {
+		t.Errorf("--config does not win over CONFIG_FILE: %+v", config)
+	}
+}
+
+func TestConfigLoaderWithoutFile(t *testing.T) {
+	t.Parallel()
+
+	l := newTestLoader(t, nil, map[string]string{"TOKEN_VERIFICATION_KEY_FILES": "a.pem,b.pem"})
+	config, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerAddress != defaults["SERVER_ADDRESS"] || len(config.TokenVerificationKeyFiles) != 2 {
+		t.Errorf("got %+v", config)
+	}
+
+	l = newTestLoader(t, nil, map[string]string{"CONFIG_FILE": "$DIR/missing.env"})
+	if _, err := l.Load(); err == nil {
+		t.Error("a missing CONFIG_FILE must be an error")
+	}
+}
+
+func TestConfigLoaderSecretFiles(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{"token_key": "from-secret-file\n"}
+
+	l := newTestLoader(t, files, map[string]string{"TOKEN_SYMMETRIC_KEY_FILE": "$DIR/token_key"})
+	config, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TokenSymmetricKey != "from-secret-file" {
+		t.Errorf("got key %q", config.TokenSymmetricKey)
+	}
+
+	l = newTestLoader(t, files, map[string]string{
+		"TOKEN_SYMMETRIC_KEY":      "from-env",
+		"TOKEN_SYMMETRIC_KEY_FILE": "$DIR/token_key",
+	})
+	if _, err := l.Load(); err == nil {
+		t.Error("setting both KEY and KEY_FILE must be an error")
+	}
+}
@@ -0,0 +1,213 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gtldhawalgandhi/go-training/3.Intermediate/logger"
+)
+
+// minSymmetricKeyLen is what HS256 and PASETO v2.local need
+const minSymmetricKeyLen = 32
+
+// minKeyEntropy is the least Shannon entropy, in bits per character, of a
+// key. Hex keys from `openssl rand -hex 16` have 3 or more, while keys like
+// "aaaa..." or "abab..." have 0 and 1.
+const minKeyEntropy = 2.5
+
+// placeholderKeys are keys from examples that are long and varied enough to
+// pass the other checks, including the one myapp.env used to ship with
+var placeholderKeys = map[string]bool{
+	"12345678901234567890123456789012": true,
+	"01234567890123456789012345678901": true,
+	"abcdefghijklmnopqrstuvwxyz123456": true,
+	"abcdefghijklmnopqrstuvwxyz012345": true,
+	"sxqeQfCCf7Fn8WamoFgcvpOjawYBvezm": true,
+}
+
+// placeholderWords give away keys that were typed in rather than generated
+var placeholderWords = []string{"changeme", "change-me", "change_me", "secret", "password", "example", "placeholder"}
+
+// Validate checks the config before anything is started with it. It reports
+// every problem at once, so they can all be fixed in one go.
+func (c Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Same values as the db package, which cannot be imported from here
+	switch c.DBDriver {
+	case "", "postgres", "sqlite":
+		if c.DBSource == "" {
+			add("DB_SOURCE is required for DB_DRIVER %q", c.DBDriver)
+		}
+	case "memory":
+	default:
+		add("DB_DRIVER %q is not one of postgres, sqlite or memory", c.DBDriver)
+	}
+	if c.DBMaxConns < 0 || c.DBMinConns < 0 {
+		add("DB_MAX_CONNS and DB_MIN_CONNS must not be negative")
+	}
+	if c.DBMaxConns > 0 && c.DBMinConns > c.DBMaxConns {
+		add("DB_MIN_CONNS (%d) is larger than DB_MAX_CONNS (%d)", c.DBMinConns, c.DBMaxConns)
+	}
+	if c.DBMaxConnLifetime < 0 || c.DBMaxConnIdleTime < 0 || c.DBHealthCheckPeriod < 0 || c.DBRequestTimeout < 0 {
+		add("database durations must not be negative")
+	}
+
+	if c.ServerAddress == "" {
+		add("SERVER_ADDRESS is required, e.g. 0.0.0.0:5555")
+	}
+	if c.HTTPReadTimeout < 0 || c.HTTPWriteTimeout < 0 || c.HTTPIdleTimeout < 0 {
+		add("HTTP timeouts must not be negative")
+	}
+	if c.HTTPWriteTimeout > 0 && c.DBRequestTimeout >= c.HTTPWriteTimeout {
+		add("DB_REQUEST_TIMEOUT (%v) must be shorter than HTTP_WRITE_TIMEOUT (%v)", c.DBRequestTimeout, c.HTTPWriteTimeout)
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	for _, file := range []string{c.TLSCertFile, c.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			add("TLS file: %v", err)
+		}
+	}
+
+	switch c.TokenType {
+	case "", "jwt":
+		// An asymmetric key ring replaces the shared secret
+		if c.TokenSigningKeyFile == "" {
+			problems = append(problems, checkSymmetricKey(c.TokenSymmetricKey)...)
+		}
+	case "paseto":
+		problems = append(problems, checkSymmetricKey(c.TokenSymmetricKey)...)
+		if len(c.TokenSymmetricKey) != minSymmetricKeyLen {
+			add("TOKEN_SYMMETRIC_KEY must be exactly %d bytes for paseto", minSymmetricKeyLen)
+		}
+	default:
+		add("TOKEN_TYPE %q is not one of jwt or paseto", c.TokenType)
+	}
+	for _, file := range append([]string{c.TokenSigningKeyFile}, c.TokenVerificationKeyFiles...) {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			add("token key file: %v", err)
+		}
+	}
+
+	if c.AccessTokenDuration <= 0 {
+		add("ACCESS_TOKEN_DURATION must be positive")
+	}
+	if c.RefreshTokenDuration <= c.AccessTokenDuration {
+		add("REFRESH_TOKEN_DURATION (%v) must be longer than ACCESS_TOKEN_DURATION (%v)", c.RefreshTokenDuration, c.AccessTokenDuration)
+	}
+	if c.TokenClockSkew < 0 || c.AccessTokenDuration > 0 && c.TokenClockSkew >= c.AccessTokenDuration {
+		add("TOKEN_CLOCK_SKEW (%v) must be between 0 and ACCESS_TOKEN_DURATION", c.TokenClockSkew)
+	}
+
+	switch c.RevocationStore {
+	case "", "store", "memory":
+	default:
+		add("REVOCATION_STORE %q is not one of store or memory", c.RevocationStore)
+	}
+	if c.RevocationPruneInterval < 0 {
+		add("REVOCATION_PRUNE_INTERVAL must not be negative")
+	}
+
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+		add("LOG_LEVEL: %v", err)
+	}
+	if c.RateLimit < 0 {
+		add("RATE_LIMIT must not be negative")
+	}
+	if c.RateLimit > 0 && c.RateLimitBurst < 1 {
+		add("RATE_LIMIT_BURST must be at least 1 when RATE_LIMIT is set")
+	}
+
+	if _, err := ParseNetworks(c.TrustedProxies); err != nil {
+		add("TRUSTED_PROXIES: %v", err)
+	}
+
+	if c.TokenIssuer == "" || c.TokenAudience == "" {
+		add("TOKEN_ISSUER and TOKEN_AUDIENCE are required, tokens from other issuers or for other services must be refused")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func checkSymmetricKey(key string) []string {
+	if key == "" {
+		return []string{"TOKEN_SYMMETRIC_KEY is required"}
+	}
+	if len(key) < minSymmetricKeyLen {
+		return []string{fmt.Sprintf("TOKEN_SYMMETRIC_KEY must be at least %d bytes, it has %d", minSymmetricKeyLen, len(key))}
+	}
+
+	weak := fmt.Sprintf("TOKEN_SYMMETRIC_KEY is a placeholder, generate one with `openssl rand -hex %d`", minSymmetricKeyLen/2)
+	if placeholderKeys[key] {
+		return []string{weak}
+	}
+	lower := strings.ToLower(key)
+	for _, word := range placeholderWords {
+		if strings.Contains(lower, word) {
+			return []string{weak}
+		}
+	}
+	if keyEntropy(key) < minKeyEntropy {
+		return []string{fmt.Sprintf("TOKEN_SYMMETRIC_KEY is too easy to guess, generate one with `openssl rand -hex %d`", minSymmetricKeyLen/2)}
+	}
+	return nil
+}
+
+// ParseNetworks parses CIDR ranges like 10.0.0.0/8. A plain address is a
+// range of its own.
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an address nor a CIDR range", s)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// keyEntropy is the Shannon entropy of the characters of key in bits per
+// character
+func keyEntropy(key string) float64 {
+	counts := make(map[byte]int)
+	for i := 0; i < len(key); i++ {
+		counts[key[i]]++
+	}
+
+	var bits float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(key))
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
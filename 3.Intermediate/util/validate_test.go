@@ -0,0 +1,85 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	return Config{
+		DBDriver:             "memory",
+		ServerAddress:        "0.0.0.0:5555",
+		ShutdownTimeout:      15 * time.Second,
+		TokenType:            "jwt",
+		TokenSymmetricKey:    "tR8cVn2LqW5xZ0pK7sD4fG1hJ9mB3yUe",
+		AccessTokenDuration:  time.Hour,
+		RefreshTokenDuration: 24 * time.Hour,
+		TokenIssuer:          "go-training",
+		TokenAudience:        "go-training-api",
+		LogLevel:             "info",
+	}
+}
+
+func TestValidateSymmetricKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		// openssl rand -hex 16 and openssl rand -base64 24
+		{"9f86d081884c7d659a2feaa0c55ad015", ""},
+		{"3b1e4c0d9a7f6e2b8c5d1a0f4e7b9c2d", ""},
+		{"q3Vb0Yl8Nw2kXc7PzR5tJm1hGf4sDa9E", ""},
+		{"", "is required"},
+		{"too-short", "at least 32 bytes"},
+		{"12345678901234567890123456789012", "placeholder"},
+		{"sxqeQfCCf7Fn8WamoFgcvpOjawYBvezm", "placeholder"},
+		{"my-very-long-jwt-secret-for-prod-2021", "placeholder"},
+		{"CHANGEME-CHANGEME-CHANGEME-CHANGE", "placeholder"},
+		{strings.Repeat("a", 32), "too easy to guess"},
+		{strings.Repeat("ab", 16), "too easy to guess"},
+	}
+	for _, tt := range tests {
+		config := validConfig()
+		config.TokenSymmetricKey = tt.key
+		err := config.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%q: %v", tt.key, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%q: got %v, want an error with %q", tt.key, err, tt.want)
+		}
+	}
+}
+
+func TestValidateRequiresIssuerAndAudience(t *testing.T) {
+	t.Parallel()
+
+	for _, clear := range []func(c *Config){
+		func(c *Config) { c.TokenIssuer = "" },
+		func(c *Config) { c.TokenAudience = "" },
+	} {
+		config := validConfig()
+		clear(&config)
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "TOKEN_ISSUER and TOKEN_AUDIENCE") {
+			t.Errorf("got %v", err)
+		}
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	config := validConfig()
+	config.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	config.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), `"proxy.internal"`) {
+		t.Errorf("got %v", err)
+	}
+}
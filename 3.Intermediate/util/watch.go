@@ -0,0 +1,106 @@
+package util
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadableKeys are the settings a running server picks up from a reload,
+// every other setting needs a restart
+var reloadableKeys = map[string]bool{
+	"LOG_LEVEL":              true,
+	"RATE_LIMIT":             true,
+	"RATE_LIMIT_BURST":       true,
+	"ACCESS_TOKEN_DURATION":  true,
+	"REFRESH_TOKEN_DURATION": true,
+}
+
+// watchDebounce waits for an editor to finish writing the config file
+const watchDebounce = 200 * time.Millisecond
+
+// RestartRequired returns the settings that differ between old and new
+// but only take effect after a restart
+func RestartRequired(old, new Config) []string {
+	var keys []string
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	for _, k := range configKeys() {
+		if reloadableKeys[k.name] {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(k.index).Interface(), nv.Field(k.index).Interface()) {
+			keys = append(keys, k.name)
+		}
+	}
+	return keys
+}
+
+// Watch reloads the config whenever the config file changes or the process
+// gets a SIGHUP, until ctx is done. onReload gets the new config, or the
+// error when it fails to load or validate, in which case it must keep the
+// config it has.
+func (l *ConfigLoader) Watch(ctx context.Context, onReload func(config Config, err error)) error {
+	file, err := l.ConfigFile()
+	if err != nil {
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	if file != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+
+		// Editors and Kubernetes config maps replace the file instead of
+		// writing to it, which only shows up on the directory
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return err
+		}
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	reload := func() {
+		config, err := l.Load()
+		if err == nil {
+			err = config.Validate()
+		}
+		onReload(config, err)
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			reload()
+		case event := <-events:
+			name := filepath.Base(event.Name)
+			// ..data is the symlink Kubernetes swaps on an update
+			if name == filepath.Base(file) || strings.HasPrefix(name, "..") {
+				debounce = time.After(watchDebounce)
+			}
+		case err := <-errs:
+			onReload(Config{}, err)
+		case <-debounce:
+			debounce = nil
+			reload()
+		}
+	}
+}
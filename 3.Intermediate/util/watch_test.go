@@ -0,0 +1,105 @@
+package util
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestartRequired(t *testing.T) {
+	t.Parallel()
+
+	old := Config{ServerAddress: "0.0.0.0:5555", LogLevel: "info", AccessTokenDuration: time.Hour}
+
+	same := old
+	same.LogLevel = "debug"
+	same.AccessTokenDuration = time.Minute
+	same.RateLimit = 10
+	if keys := RestartRequired(old, same); len(keys) != 0 {
+		t.Errorf("reloadable changes need a restart: %v", keys)
+	}
+
+	changed := same
+	changed.ServerAddress = "0.0.0.0:6666"
+	changed.TokenVerificationKeyFiles = []string{"old.pem"}
+	want := []string{"SERVER_ADDRESS", "TOKEN_VERIFICATION_KEY_FILES"}
+	if keys := RestartRequired(old, changed); !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %v, want %v", keys, want)
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	t.Parallel()
+
+	base := "DB_DRIVER=memory\nTOKEN_SYMMETRIC_KEY=tR8cVn2LqW5xZ0pK7sD4fG1hJ9mB3yUe\nTOKEN_ISSUER=go-training\nTOKEN_AUDIENCE=go-training-api\n"
+	l := newTestLoader(t, map[string]string{"myapp.env": base + "LOG_LEVEL=info\n"}, nil)
+	file, err := l.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type reload struct {
+		config Config
+		err    error
+	}
+	reloads := make(chan reload, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Watch(ctx, func(config Config, err error) {
+			reloads <- reload{config, err}
+		})
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Keep writing until the watcher is up and reports the change
+	write := func(content string) reload {
+		t.Helper()
+		for i := 0; i < 50; i++ {
+			if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case r := <-reloads:
+				return r
+			case <-time.After(2 * watchDebounce):
+			}
+		}
+		t.Fatal("config file change was not noticed")
+		return reload{}
+	}
+
+	r := write(base + "LOG_LEVEL=debug\n")
+	if r.err != nil || r.config.LogLevel != "debug" {
+		t.Fatalf("got %q, %v, want debug", r.config.LogLevel, r.err)
+	}
+
+	// A bad file is reported and not applied
+	r = write(base + "LOG_LEVEL=loud\n")
+	if r.err == nil || !strings.Contains(r.err.Error(), "LOG_LEVEL") {
+		t.Fatalf("got %v, want a LOG_LEVEL error", r.err)
+	}
+}
+
+func TestWatchWithoutFile(t *testing.T) {
+	t.Parallel()
+
+	l := newTestLoader(t, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := l.Watch(ctx, func(Config, error) {
+		t.Error("reloaded without a change")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}